@@ -0,0 +1,202 @@
+package lib
+
+import (
+	"fmt"
+	"math"
+)
+
+// ArrivalModel decides which query templates arrive on a tick. probs holds the mean number of
+// arrivals per tick for each template and scalar the current load multiplier. It returns the
+// template index of every arrival, so an index appears once per arrival and may repeat.
+type ArrivalModel interface {
+	Arrivals(probs *[]float64, scalar float64) []int
+}
+
+const (
+	BernoulliArrivals = "bernoulli" // at most one arrival per template per tick
+	PoissonArrivals   = "poisson"   // independent Poisson counts per template
+	MarkovArrivals    = "markov"    // Poisson counts modulated by a shared on/off Markov chain
+	HawkesArrivals    = "hawkes"    // self-exciting counts, where each arrival raises the rate of its template
+)
+
+// ArrivalConfig selects the arrival model and holds the parameters of the bursty models
+type ArrivalConfig struct {
+	Model       string  `json:"model"`        // Model is the name of the arrival model
+	BurstFactor float64 `json:"burst_factor"` // BurstFactor is the rate multiplier of the markov model while on
+	OnToOff     float64 `json:"on_to_off"`    // OnToOff is the per-tick probability the markov model turns off
+	OffToOn     float64 `json:"off_to_on"`    // OffToOn is the per-tick probability the markov model turns on
+	Excitation  float64 `json:"excitation"`   // Excitation is the rate added to a template by each of its hawkes arrivals
+	Decay       float64 `json:"decay"`        // Decay is the per-tick exponential decay rate of the hawkes excitation
+}
+
+func defaultArrivalConfig() ArrivalConfig {
+	return ArrivalConfig{
+		Model:       BernoulliArrivals,
+		BurstFactor: 4,
+		OnToOff:     0.1,
+		OffToOn:     0.02,
+		Excitation:  0.3,
+		Decay:       0.5,
+	}
+}
+
+func (c ArrivalConfig) validate() error {
+	switch c.Model {
+	case BernoulliArrivals, PoissonArrivals:
+	case MarkovArrivals:
+		if c.BurstFactor < 1 {
+			return fmt.Errorf("burst_factor must be at least 1")
+		}
+		if c.OnToOff <= 0 || c.OnToOff > 1 || c.OffToOn <= 0 || c.OffToOn > 1 {
+			return fmt.Errorf("on_to_off and off_to_on must be in (0, 1]")
+		}
+		if c.onShare()*c.BurstFactor > 1 {
+			return fmt.Errorf("burst_factor is too high for the time spent on")
+		}
+	case HawkesArrivals:
+		if c.Excitation < 0 || c.Decay <= 0 {
+			return fmt.Errorf("excitation must not be negative and decay must be positive")
+		}
+		if c.branchingRatio() >= 1 {
+			return fmt.Errorf("excitation is too high for the decay, arrivals would explode")
+		}
+	default:
+		return fmt.Errorf("unknown arrival model %q", c.Model)
+	}
+	return nil
+}
+
+// onShare is the long-run fraction of ticks the markov model spends on
+func (c ArrivalConfig) onShare() float64 {
+	return c.OffToOn / (c.OffToOn + c.OnToOff)
+}
+
+// branchingRatio is the expected number of arrivals triggered by a single hawkes arrival
+func (c ArrivalConfig) branchingRatio() float64 {
+	return c.Excitation / (math.Exp(c.Decay) - 1)
+}
+
+// newArrivalModel returns the configured model, drawing from rng, which it must only use on the daemon goroutine
+func newArrivalModel(cfg ArrivalConfig, rng randSource) (ArrivalModel, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	switch cfg.Model {
+	case PoissonArrivals:
+		return poissonModel{rng: rng}, nil
+	case MarkovArrivals:
+		// The off rate is chosen so the long-run mean matches the other models
+		on := cfg.onShare()
+		return &markovModel{
+			rng:     rng,
+			onRate:  cfg.BurstFactor,
+			offRate: (1 - on*cfg.BurstFactor) / (1 - on),
+			onToOff: cfg.OnToOff,
+			offToOn: cfg.OffToOn,
+		}, nil
+	case HawkesArrivals:
+		return &hawkesModel{
+			rng:        rng,
+			excitation: cfg.Excitation,
+			decay:      math.Exp(-cfg.Decay),
+			baseline:   1 - cfg.branchingRatio(),
+		}, nil
+	default:
+		return bernoulliModel{rng: rng}, nil
+	}
+}
+
+// bernoulliModel draws one Bernoulli trial per template per tick
+type bernoulliModel struct {
+	rng randSource
+}
+
+func (m bernoulliModel) Arrivals(probs *[]float64, scalar float64) []int {
+	return selectExecutedIdx(m.rng, probs, scalar)
+}
+
+// poissonModel draws a Poisson count per template per tick
+type poissonModel struct {
+	rng randSource
+}
+
+func (m poissonModel) Arrivals(probs *[]float64, scalar float64) []int {
+	return poissonArrivals(m.rng, probs, func(i int) float64 { return (*probs)[i] * scalar })
+}
+
+// markovModel is a Markov-modulated Poisson process: all templates share an on/off state,
+// arriving at a multiple of their rate while on and a fraction of it while off
+type markovModel struct {
+	rng     randSource
+	on      bool
+	onRate  float64
+	offRate float64
+	onToOff float64
+	offToOn float64
+}
+
+func (m *markovModel) Arrivals(probs *[]float64, scalar float64) []int {
+	if m.on && m.rng.Float64() < m.onToOff {
+		m.on = false
+	} else if !m.on && m.rng.Float64() < m.offToOn {
+		m.on = true
+	}
+
+	rate := m.offRate
+	if m.on {
+		rate = m.onRate
+	}
+	return poissonArrivals(m.rng, probs, func(i int) float64 { return (*probs)[i] * scalar * rate })
+}
+
+// hawkesModel is a discrete-time Hawkes process per template: each arrival adds excitation to
+// its template's rate, which decays geometrically each tick. The baseline rate is scaled down by
+// the branching ratio so the long-run mean matches the other models.
+type hawkesModel struct {
+	rng        randSource
+	excitation float64
+	decay      float64
+	baseline   float64
+	excited    []float64
+}
+
+func (m *hawkesModel) Arrivals(probs *[]float64, scalar float64) []int {
+	if len(m.excited) != len(*probs) {
+		m.excited = make([]float64, len(*probs))
+	}
+	for i := range m.excited {
+		m.excited[i] *= m.decay
+	}
+
+	arrivals := poissonArrivals(m.rng, probs, func(i int) float64 {
+		return (*probs)[i]*scalar*m.baseline + m.excited[i]
+	})
+	for _, idx := range arrivals {
+		m.excited[idx] += m.excitation
+	}
+	return arrivals
+}
+
+// poissonArrivals draws a Poisson count for each template with the given rate
+func poissonArrivals(rng randSource, probs *[]float64, rate func(int) float64) []int {
+	arrivals := make([]int, 0)
+	for i := 0; i < len(*probs); i++ {
+		for n := poisson(rng, rate(i)); n > 0; n-- {
+			arrivals = append(arrivals, i)
+		}
+	}
+	return arrivals
+}
+
+// poisson draws from a Poisson distribution using Knuth's algorithm, which is fast for the small rates used per tick
+func poisson(rng randSource, lambda float64) int {
+	if lambda <= 0 {
+		return 0
+	}
+	limit := math.Exp(-lambda)
+	n := 0
+	for p := rng.Float64(); p > limit; p *= rng.Float64() {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,84 @@
+package lib
+
+// arrivalMoments returns the mean and variance of the number of arrivals per tick
+func arrivalMoments(model ArrivalModel, probs *[]float64, ticks int) (float64, float64) {
+	counts := make([]int, ticks)
+	mean := 0.0
+	for i := range counts {
+		counts[i] = len(model.Arrivals(probs, 1))
+		mean += float64(counts[i])
+	}
+	mean /= float64(ticks)
+
+	variance := 0.0
+	for _, count := range counts {
+		variance += (float64(count) - mean) * (float64(count) - mean)
+	}
+	return mean, variance / float64(ticks)
+}
+
+func uniformProbs(n int, total float64) *[]float64 {
+	probs := make([]float64, n)
+	for i := range probs {
+		probs[i] = total / float64(n)
+	}
+	return &probs
+}
+
+func (s *TestSuite) TestArrivalModelsPreserveMean() {
+	probs := uniformProbs(100, 1)
+	for _, name := range []string{BernoulliArrivals, PoissonArrivals, MarkovArrivals, HawkesArrivals} {
+		cfg := defaultArrivalConfig()
+		cfg.Model = name
+		model, err := newArrivalModel(cfg, processRand{})
+		s.NoError(err)
+
+		mean, _ := arrivalMoments(model, probs, 50000)
+		s.InDelta(1, mean, 0.15, name)
+	}
+}
+
+func (s *TestSuite) TestBurstyArrivalsAreOverdispersed() {
+	probs := uniformProbs(100, 1)
+	cfg := defaultArrivalConfig()
+
+	_, poissonVariance := arrivalMoments(poissonModel{rng: processRand{}}, probs, 50000)
+	s.InDelta(1, poissonVariance, 0.15)
+
+	cfg.Model = MarkovArrivals
+	markov, err := newArrivalModel(cfg, processRand{})
+	s.NoError(err)
+	_, markovVariance := arrivalMoments(markov, probs, 50000)
+	s.Greater(markovVariance, 1.5*poissonVariance)
+
+	cfg.Model = HawkesArrivals
+	hawkes, err := newArrivalModel(cfg, processRand{})
+	s.NoError(err)
+	_, hawkesVariance := arrivalMoments(hawkes, probs, 50000)
+	s.Greater(hawkesVariance, poissonVariance)
+}
+
+func (s *TestSuite) TestArrivalConfigValidation() {
+	cfg := defaultArrivalConfig()
+	cfg.Model = "uniform"
+	s.Error(cfg.validate())
+
+	cfg = defaultArrivalConfig()
+	cfg.Model = HawkesArrivals
+	cfg.Excitation = 1
+	s.Error(cfg.validate())
+
+	cfg = defaultArrivalConfig()
+	cfg.Model = MarkovArrivals
+	cfg.BurstFactor = 100
+	s.Error(cfg.validate())
+}
+
+func (s *TestSuite) TestPoisson() {
+	total := 0
+	for i := 0; i < 100000; i++ {
+		total += poisson(processRand{}, 2)
+	}
+	s.InDelta(2, float64(total)/100000, 0.05)
+	s.Equal(0, poisson(processRand{}, 0))
+}
@@ -0,0 +1,116 @@
+package lib
+
+import (
+	"fmt"
+	"sort"
+)
+
+// BackpressurePolicy is what the queue does when it holds more executions than its maximum depth
+type BackpressurePolicy string
+
+const (
+	BackpressureReject   BackpressurePolicy = "reject"    // drop the newest arrivals beyond the limit
+	BackpressureEvict    BackpressurePolicy = "evict"     // drop the lowest priority executions queued, the newest of them first
+	BackpressureForceRun BackpressurePolicy = "force_run" // run the oldest executions queued
+)
+
+// BackpressureConfig bounds the number of executions the queue holds, so that a scheduler
+// deferring too much sheds load visibly instead of growing the queue without limit
+type BackpressureConfig struct {
+	MaxDepth int                `json:"max_depth"` // MaxDepth is the most executions queued at the end of a tick, 0 for no limit
+	Policy   BackpressurePolicy `json:"policy"`    // Policy is applied to the executions beyond the limit
+}
+
+func defaultBackpressureConfig() BackpressureConfig {
+	return BackpressureConfig{Policy: BackpressureReject}
+}
+
+func (c BackpressureConfig) validate() error {
+	if c.Policy != BackpressureReject && c.Policy != BackpressureEvict && c.Policy != BackpressureForceRun {
+		return fmt.Errorf("unknown backpressure policy %q", c.Policy)
+	}
+	if c.MaxDepth < 0 {
+		return fmt.Errorf("backpressure max_depth must not be negative")
+	}
+	return nil
+}
+
+// shed brings the queue back within its maximum depth by applying the backpressure policy to the
+// executions beyond it. Rejecting only drops the arrivals of this tick, so the queue may stay over
+// the limit when it was already over it. A dropped execution takes its queued dependents with it,
+// a member of a chain is only run early once its chain lets it, and a transaction only runs in full.
+// It returns the executions to run on top of the scheduled ones.
+func (q *Queue) shed(arrivals []*Execution) []*Execution {
+	excess := len(q.queued) - q.backpressure.MaxDepth
+	if q.backpressure.MaxDepth == 0 || excess <= 0 {
+		return nil
+	}
+
+	var candidates []*Execution
+	switch q.backpressure.Policy {
+	case BackpressureReject:
+		for i := len(arrivals) - 1; i >= 0; i-- {
+			candidates = append(candidates, arrivals[i])
+		}
+	case BackpressureEvict:
+		candidates = q.getQueued()
+		sort.Slice(candidates, func(i, j int) bool {
+			if candidates[i].priority != candidates[j].priority {
+				return candidates[i].priority < candidates[j].priority
+			}
+			return candidates[i].queuedAt > candidates[j].queuedAt
+		})
+	case BackpressureForceRun:
+		candidates = q.getQueued()
+		sortByAge(candidates)
+	}
+
+	var executed []*Execution
+	for _, execution := range candidates {
+		if len(q.queued) <= q.backpressure.MaxDepth {
+			break
+		}
+		if _, ok := q.queued[execution.id]; !ok {
+			// Dropped along with an execution it depends on
+			continue
+		}
+		switch q.backpressure.Policy {
+		case BackpressureReject, BackpressureEvict:
+			eventType, reason := EventDropped, "rejected"
+			if q.backpressure.Policy == BackpressureEvict {
+				eventType, reason = EventEvicted, "evicted"
+			}
+			delete(q.queued, execution.id)
+			q.emit(eventType, execution)
+			q.transition(execution, StateDropped, ActorPolicy, reason)
+			q.expireDependents(execution)
+		case BackpressureForceRun:
+			for _, member := range q.runTogether(execution) {
+				delete(q.queued, member.id)
+				q.emit(EventOverflow, member)
+				executed = append(executed, member)
+			}
+		}
+	}
+	return executed
+}
+
+// runTogether returns the executions to run early along with the execution: its whole transaction
+// if every member is still queued, or itself once its chain lets it run. It returns none otherwise.
+func (q *Queue) runTogether(execution *Execution) []*Execution {
+	if execution.group == nil {
+		return []*Execution{execution}
+	}
+	if execution.group.kind == GroupChain {
+		if !execution.group.ready(execution) {
+			return nil
+		}
+		return []*Execution{execution}
+	}
+	for _, member := range execution.group.members {
+		if _, ok := q.queued[member.id]; !ok {
+			return nil
+		}
+	}
+	return execution.group.members
+}
@@ -0,0 +1,87 @@
+package lib
+
+import (
+	"github.com/google/uuid"
+)
+
+// fullQueue returns a queue on which three low priority executions arrive on every tick and are held
+func fullQueue(cfg BackpressureConfig) *Queue {
+	queries := getQueries(3)
+	for _, query := range queries {
+		query.priority = PriorityLow
+	}
+	queue := newQueue(queries, &[]float64{1, 1, 1}, 1)
+	queue.scheduler = holdScheduler{}
+	queue.backpressure = cfg
+	return queue
+}
+
+func (s *TestSuite) TestBackpressureReject() {
+	queue := fullQueue(BackpressureConfig{MaxDepth: 4, Policy: BackpressureReject})
+	arrived, _ := queue.tick(1)
+	s.Len(arrived, 3)
+	s.Empty(queue.drainEvents())
+
+	arrived, executed := queue.tick(1)
+	s.Len(arrived, 1)
+	s.Empty(executed)
+	s.Len(queue.queued, 4)
+	s.Contains(queue.queued, arrived[0].id)
+	s.Equal(QueueStats{Dropped: 2}, countEvents(queue.drainEvents()))
+}
+
+func (s *TestSuite) TestBackpressureEvict() {
+	queue := fullQueue(BackpressureConfig{MaxDepth: 2, Policy: BackpressureEvict})
+	query := getQuery(CPU)
+	high := newExecution(query, uuid.New(), 10)
+	high.priority = PriorityHigh
+	queue.queued[high.id] = high
+
+	queue.tick(1)
+	s.Len(queue.queued, 2)
+	s.Contains(queue.queued, high.id)
+	s.Equal(QueueStats{Evicted: 2}, countEvents(queue.drainEvents()))
+}
+
+func (s *TestSuite) TestBackpressureForceRun() {
+	queue := fullQueue(BackpressureConfig{MaxDepth: 3, Policy: BackpressureForceRun})
+	queue.tick(1)
+	oldest := queue.getQueued()
+
+	arrived, executed := queue.tick(1)
+	s.Len(arrived, 3)
+	s.ElementsMatch(oldest, executed)
+	s.Len(queue.queued, 3)
+	s.Equal(QueueStats{Overflow: 3}, countEvents(queue.drainEvents()))
+}
+
+func (s *TestSuite) TestBackpressureDropsDependents() {
+	queue, members := groupQueue(GroupChain)
+	s.Require().Len(members, 3)
+	members[1].priority = PriorityNormal
+	members[2].priority = PriorityNormal
+	queue.backpressure = BackpressureConfig{MaxDepth: 2, Policy: BackpressureEvict}
+
+	// Evicting the first member of the chain leaves the others unable to run
+	s.Empty(queue.shed(nil))
+	s.Empty(queue.queued)
+	s.Equal(QueueStats{Evicted: 1, Expired: 2}, countEvents(queue.drainEvents()))
+}
+
+func (s *TestSuite) TestBackpressureForceRunsWholeTransaction() {
+	queue, members := groupQueue(GroupTransaction)
+	s.Require().Len(members, 3)
+	queue.backpressure = BackpressureConfig{MaxDepth: 2, Policy: BackpressureForceRun}
+
+	// Running one member early would split the transaction, so all of them run
+	s.ElementsMatch(members, queue.shed(nil))
+	s.Empty(queue.queued)
+	s.Equal(QueueStats{Overflow: 3}, countEvents(queue.drainEvents()))
+
+	// A transaction missing a member is left queued
+	queue, members = groupQueue(GroupTransaction)
+	delete(queue.queued, members[2].id)
+	queue.backpressure = BackpressureConfig{MaxDepth: 1, Policy: BackpressureForceRun}
+	s.Empty(queue.shed(nil))
+	s.Len(queue.queued, 2)
+}
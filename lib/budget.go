@@ -0,0 +1,59 @@
+package lib
+
+import "fmt"
+
+// Budget is the maximum usage of each resource the queue lets run in a single tick.
+// A missing or zero value for a resource leaves that resource unlimited.
+type Budget Resources
+
+func (b Budget) enabled() bool {
+	for _, limit := range b {
+		if limit > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (b Budget) validate() error {
+	for name, limit := range b {
+		if limit < 0 {
+			return fmt.Errorf("budget for %s must not be negative", name)
+		}
+	}
+	return nil
+}
+
+// fits reports whether adding the query to usage stays within the budget
+func (b Budget) fits(usage Resources, query *Query) bool {
+	for name, limit := range b {
+		if limit > 0 && usage[name]+query.usage[name] > limit {
+			return false
+		}
+	}
+	return true
+}
+
+// apply admits executions in priority then age order until the budget, less the usage already in flight,
+// is exhausted and returns the overflow to carry. Only deferrable (low priority) executions are carried;
+// once one overflows, the younger ones are carried behind it. The first execution is always admitted,
+// so a query larger than the budget cannot stall the queue.
+func (b Budget) apply(executions []*Execution, inFlight Resources) ([]*Execution, []*Execution) {
+	if !b.enabled() {
+		return executions, nil
+	}
+	sortByPriority(executions)
+
+	usage := inFlight.clone()
+	run := make([]*Execution, 0, len(executions))
+	carried := make([]*Execution, 0)
+	for _, execution := range executions {
+		if execution.priority.deferrable() && len(run) > 0 && (len(carried) > 0 || !b.fits(usage, execution.query)) {
+			carried = append(carried, execution)
+			continue
+		}
+		run = append(run, execution)
+		usage.add(execution.query.usage, 1)
+	}
+	return run, carried
+}
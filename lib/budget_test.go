@@ -0,0 +1,90 @@
+package lib
+
+import "github.com/google/uuid"
+
+func (s *TestSuite) TestBudgetApply() {
+	query := &Query{usage: Resources{ResourceCPU: 40, ResourceMemory: 10, ResourceIO: 10}}
+	executions := []*Execution{
+		{query: query, queuedAt: 3},
+		{query: query, queuedAt: 1},
+		{query: query, queuedAt: 2},
+	}
+
+	run, carried := Budget{ResourceCPU: 100}.apply(executions, Resources{})
+	s.Len(run, 2)
+	s.Len(carried, 1)
+	s.Equal(1, run[0].queuedAt)
+	s.Equal(2, run[1].queuedAt)
+	s.Equal(3, carried[0].queuedAt)
+}
+
+func (s *TestSuite) TestBudgetDisabled() {
+	query := &Query{usage: Resources{ResourceCPU: 400}}
+	executions := []*Execution{{query: query}, {query: query}}
+	run, carried := Budget{}.apply(executions, Resources{})
+	s.Len(run, 2)
+	s.Empty(carried)
+}
+
+func (s *TestSuite) TestBudgetAdmitsOversizedExecution() {
+	query := &Query{usage: Resources{ResourceCPU: 400}}
+	executions := []*Execution{{query: query}, {query: query}}
+	run, carried := Budget{ResourceCPU: 100}.apply(executions, Resources{})
+	s.Len(run, 1)
+	s.Len(carried, 1)
+}
+
+func (s *TestSuite) TestBudgetOnlyCarriesLowPriority() {
+	query := &Query{usage: Resources{ResourceCPU: 60}}
+	executions := []*Execution{
+		{query: query, queuedAt: 1, priority: PriorityLow},
+		{query: query, queuedAt: 2, priority: PriorityHigh},
+		{query: query, queuedAt: 3, priority: PriorityNormal},
+		{query: query, queuedAt: 4, priority: PriorityLow},
+	}
+
+	run, carried := Budget{ResourceCPU: 100}.apply(executions, Resources{})
+	s.Len(run, 2)
+	s.Equal(PriorityHigh, run[0].priority)
+	s.Equal(PriorityNormal, run[1].priority)
+	s.Len(carried, 2)
+	s.Equal(1, carried[0].queuedAt)
+	s.Equal(4, carried[1].queuedAt)
+}
+
+func (s *TestSuite) TestQueueCarriesOverflow() {
+	queries := getQueries(100)
+	for _, query := range queries {
+		query.priority = PriorityLow
+	}
+	probs := getExecutionProbs(100)
+	queue := newQueue(queries, probs, 1)
+	queue.budget = Budget{ResourceCPU: 100, ResourceMemory: 100, ResourceIO: 100}
+
+	carried := 0
+	for i := 0; i < 1000; i++ {
+		_, executed := queue.tick(3)
+		// Only a single execution may exceed the budget, as the first is always admitted
+		summed := sumResources(executed)
+		if len(executed) > 1 {
+			s.LessOrEqual(summed.Usage[ResourceCPU], 100)
+			s.LessOrEqual(summed.Usage[ResourceMemory], 100)
+			s.LessOrEqual(summed.Usage[ResourceIO], 100)
+		}
+
+		// Every carried execution is back in the queue, due on the next tick
+		for _, event := range queue.drainEvents() {
+			if event.Type != EventCarried {
+				continue
+			}
+			execution, ok := queue.queued[uuid.MustParse(event.Execution)]
+			s.Require().True(ok)
+			s.Equal(1, execution.delay)
+			carried++
+		}
+		for _, execution := range queue.queued {
+			s.GreaterOrEqual(execution.delay, 1)
+		}
+	}
+	s.Positive(carried)
+}
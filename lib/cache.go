@@ -0,0 +1,134 @@
+package lib
+
+import (
+	"container/list"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// CacheConfig controls the query result cache. An execution of a query template whose result
+// is cached costs only a share of its usage of the cached resource.
+type CacheConfig struct {
+	Capacity int     `json:"capacity"` // Capacity is the number of query results cached, 0 to disable the cache
+	Window   int     `json:"window"`   // Window is the number of ticks a result stays valid after it is computed, 0 for no expiry
+	HitCost  float64 `json:"hit_cost"` // HitCost is the share of the usage of the cached resource a hit costs
+	Resource string  `json:"resource"` // Resource is the resource a hit saves
+}
+
+func defaultCacheConfig() CacheConfig {
+	return CacheConfig{
+		Window:   100,
+		HitCost:  0.1,
+		Resource: ResourceIO,
+	}
+}
+
+func (c CacheConfig) validate() error {
+	if c.Capacity < 0 || c.Window < 0 {
+		return fmt.Errorf("cache capacity and window must not be negative")
+	}
+	if c.HitCost < 0 || c.HitCost > 1 {
+		return fmt.Errorf("cache hit_cost must be between 0 and 1")
+	}
+	if c.Resource == "" {
+		return fmt.Errorf("cache needs a resource")
+	}
+	return nil
+}
+
+// CacheStats counts cache lookups over a period
+type CacheStats struct {
+	Hits      int `json:"hits"`
+	Misses    int `json:"misses"`
+	Evictions int `json:"evictions"` // Evictions counts results dropped to make room, not those that expired
+}
+
+func (s *CacheStats) add(other CacheStats) {
+	s.Hits += other.Hits
+	s.Misses += other.Misses
+	s.Evictions += other.Evictions
+}
+
+// cacheEntry is a cached result and the tick it was computed on
+type cacheEntry struct {
+	query    uuid.UUID
+	computed int
+}
+
+// queryCache is an LRU cache of query results, keyed by query template
+type queryCache struct {
+	cfg     CacheConfig
+	entries map[uuid.UUID]*list.Element
+	lru     *list.List // lru holds the entries, most recently used first
+	tick    CacheStats // tick counts the lookups since the last drain
+	mu      sync.Mutex // mu guards total, which is read while the queue runs
+	total   CacheStats // total counts the lookups since startup
+}
+
+func newQueryCache(cfg CacheConfig) *queryCache {
+	return &queryCache{
+		cfg:     cfg,
+		entries: make(map[uuid.UUID]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// apply looks up the result of each query run on the given tick. A hit reduces the execution's
+// usage of the cached resource, and a miss caches the result, evicting the least recently used one if full.
+// Maintenance tasks produce no result, so they bypass the cache.
+func (c *queryCache) apply(executions []*Execution, tick int) {
+	stats := CacheStats{}
+	for _, execution := range executions {
+		if execution.kind == KindMaintenance {
+			continue
+		}
+		id := execution.query.id
+		if element, ok := c.entries[id]; ok {
+			entry := element.Value.(*cacheEntry)
+			if c.cfg.Window == 0 || tick-entry.computed <= c.cfg.Window {
+				stats.Hits++
+				c.lru.MoveToFront(element)
+				if usage, ok := execution.usage[c.cfg.Resource]; ok {
+					execution.usage[c.cfg.Resource] = int(math.Round(float64(usage) * c.cfg.HitCost))
+				}
+				continue
+			}
+			// The result expired, so it is computed again
+			stats.Misses++
+			entry.computed = tick
+			c.lru.MoveToFront(element)
+			continue
+		}
+
+		stats.Misses++
+		if c.lru.Len() >= c.cfg.Capacity {
+			oldest := c.lru.Back()
+			delete(c.entries, oldest.Value.(*cacheEntry).query)
+			c.lru.Remove(oldest)
+			stats.Evictions++
+		}
+		c.entries[id] = c.lru.PushFront(&cacheEntry{query: id, computed: tick})
+	}
+
+	c.tick.add(stats)
+	c.mu.Lock()
+	c.total.add(stats)
+	c.mu.Unlock()
+}
+
+// drain returns the lookups since the last call
+func (c *queryCache) drain() CacheStats {
+	stats := c.tick
+	c.tick = CacheStats{}
+	return stats
+}
+
+// totals returns the lookups since startup
+func (c *queryCache) totals() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.total
+}
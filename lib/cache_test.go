@@ -0,0 +1,74 @@
+package lib
+
+import (
+	"github.com/google/uuid"
+)
+
+func (s *TestSuite) TestCacheHitsWithinWindow() {
+	query := &Query{id: uuid.New()}
+	cache := newQueryCache(CacheConfig{Capacity: 2, Window: 5, HitCost: 0.25, Resource: ResourceIO})
+	execute := func(tick int) *Execution {
+		execution := &Execution{query: query, usage: Resources{ResourceCPU: 40, ResourceIO: 80}}
+		cache.apply([]*Execution{execution}, tick)
+		return execution
+	}
+
+	s.Equal(80, execute(1).usage[ResourceIO])
+	hit := execute(6)
+	s.Equal(20, hit.usage[ResourceIO])
+	s.Equal(40, hit.usage[ResourceCPU])
+
+	// The result expires after the window and is computed again
+	s.Equal(80, execute(7).usage[ResourceIO])
+	s.Equal(20, execute(8).usage[ResourceIO])
+
+	s.Equal(CacheStats{Hits: 2, Misses: 2}, cache.drain())
+	s.Equal(CacheStats{}, cache.drain())
+	s.Equal(CacheStats{Hits: 2, Misses: 2}, cache.totals())
+}
+
+func (s *TestSuite) TestCacheEvictsLeastRecentlyUsed() {
+	a, b, c := &Query{id: uuid.New()}, &Query{id: uuid.New()}, &Query{id: uuid.New()}
+	cache := newQueryCache(CacheConfig{Capacity: 2, HitCost: 0, Resource: ResourceIO})
+	execute := func(query *Query) {
+		cache.apply([]*Execution{{query: query, usage: Resources{ResourceIO: 10}}}, 1)
+	}
+
+	execute(a)
+	execute(b)
+	execute(a) // a is now the most recently used
+	execute(c) // evicts b
+	s.Equal(CacheStats{Hits: 1, Misses: 3, Evictions: 1}, cache.drain())
+
+	execute(a)
+	execute(b)
+	s.Equal(CacheStats{Hits: 1, Misses: 1, Evictions: 1}, cache.drain())
+}
+
+func (s *TestSuite) TestQueueCacheLowersIO() {
+	queries := getQueries(3)
+	probs := []float64{1, 1, 1}
+	queue := newQueue(queries, &probs, 0)
+	queue.cache = newQueryCache(CacheConfig{Capacity: 3, HitCost: 0, Resource: ResourceIO})
+
+	// Arrivals run on the tick after they are queued
+	queue.tick(1)
+	_, executed := queue.tick(1)
+	s.Len(executed, 3)
+	for _, execution := range executed {
+		s.Equal(execution.query.usage[ResourceIO], execution.usage[ResourceIO])
+	}
+	_, executed = queue.tick(1)
+	s.Len(executed, 3)
+	for _, execution := range executed {
+		s.Equal(0, execution.usage[ResourceIO])
+	}
+	s.Equal(CacheStats{Hits: 3, Misses: 3}, queue.cache.drain())
+}
+
+func (s *TestSuite) TestCacheValidation() {
+	s.NoError(defaultCacheConfig().validate())
+	s.Error(CacheConfig{Capacity: -1, Resource: ResourceIO}.validate())
+	s.Error(CacheConfig{HitCost: 2, Resource: ResourceIO}.validate())
+	s.Error(CacheConfig{}.validate())
+}
@@ -0,0 +1,70 @@
+package lib
+
+import (
+	"fmt"
+	"math"
+)
+
+// CapacityConfig bounds the resources the executions in flight can use in a tick. When their
+// demand exceeds it, they slow down and run for more ticks than their duration.
+type CapacityConfig struct {
+	Limits     Resources `json:"limits"`     // Limits is the capacity of each resource per tick, missing or 0 for unlimited
+	Contention float64   `json:"contention"` // Contention is how superlinearly executions of the same profile contend, 0 for linearly
+}
+
+func (c CapacityConfig) validate() error {
+	for name, limit := range c.Limits {
+		if limit < 0 {
+			return fmt.Errorf("capacity for %s must not be negative", name)
+		}
+	}
+	if c.Contention < 0 {
+		return fmt.Errorf("capacity contention must not be negative")
+	}
+	return nil
+}
+
+func (c CapacityConfig) enabled() bool {
+	for _, limit := range c.Limits {
+		if limit > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// progress returns the share of a tick's work each execution completes given its demand this tick.
+// Every resource over capacity slows the executions using it in proportion, and an execution
+// progresses at the rate of its most saturated resource. Demand is weighted by n^Contention for
+// the n executions in flight of the same profile, so similar queries saturate a resource sooner.
+func (c CapacityConfig) progress(demands []Resources, profiles []Profile) []float64 {
+	progress := make([]float64, len(demands))
+	for i := range progress {
+		progress[i] = 1
+	}
+	if !c.enabled() {
+		return progress
+	}
+
+	sameProfile := make(map[Profile]int)
+	for _, profile := range profiles {
+		sameProfile[profile]++
+	}
+	pressure := make(map[string]float64)
+	for i, demand := range demands {
+		weight := math.Pow(float64(sameProfile[profiles[i]]), c.Contention)
+		for name, usage := range demand {
+			pressure[name] += float64(usage) * weight
+		}
+	}
+
+	for i, demand := range demands {
+		for name, usage := range demand {
+			limit := c.Limits[name]
+			if usage > 0 && limit > 0 && pressure[name] > float64(limit) {
+				progress[i] = math.Min(progress[i], float64(limit)/pressure[name])
+			}
+		}
+	}
+	return progress
+}
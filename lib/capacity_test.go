@@ -0,0 +1,59 @@
+package lib
+
+func (s *TestSuite) TestCapacityProgress() {
+	demands := []Resources{{ResourceCPU: 60, ResourceIO: 10}, {ResourceCPU: 60}, {ResourceMemory: 50}}
+	profiles := []Profile{CPU, IO, Memory}
+
+	s.Equal([]float64{1, 1, 1}, CapacityConfig{}.progress(demands, profiles))
+
+	progress := CapacityConfig{Limits: Resources{ResourceCPU: 100, ResourceMemory: 100}}.progress(demands, profiles)
+	s.InDelta(100.0/120, progress[0], 1e-9)
+	s.InDelta(100.0/120, progress[1], 1e-9)
+	s.Equal(1.0, progress[2])
+}
+
+func (s *TestSuite) TestCapacityContention() {
+	demands := []Resources{{ResourceCPU: 40}, {ResourceCPU: 40}}
+	limits := Resources{ResourceCPU: 100}
+
+	// Linearly, 80 fits within 100
+	s.Equal([]float64{1, 1}, CapacityConfig{Limits: limits}.progress(demands, []Profile{CPU, CPU}))
+
+	// Two executions of the same profile weigh double, so 160 saturates the CPU
+	progress := CapacityConfig{Limits: limits, Contention: 1}.progress(demands, []Profile{CPU, CPU})
+	s.InDelta(100.0/160, progress[0], 1e-9)
+
+	// Executions of different profiles do not contend
+	s.Equal([]float64{1, 1}, CapacityConfig{Limits: limits, Contention: 1}.progress(demands, []Profile{CPU, IO}))
+}
+
+func (s *TestSuite) TestRunSetSaturation() {
+	query := &Query{shape: FlatShape, profile: CPU}
+	running := newRunSet()
+	running.capacity = CapacityConfig{Limits: Resources{ResourceCPU: 100}}
+	running.latency = newLatencyRecorder()
+
+	running.start([]*Execution{
+		{query: query, duration: 2, usage: Resources{ResourceCPU: 100}},
+		{query: query, duration: 2, usage: Resources{ResourceCPU: 100}},
+	})
+	for i := 0; i < 3; i++ {
+		update := running.tick()
+		s.Equal(Resources{ResourceCPU: 100}, update.Usage)
+		s.Equal(2, update.Throttled)
+		s.Equal(2, update.Running)
+	}
+	update := running.tick()
+	s.Equal(2, update.Throttled)
+	s.Empty(running.running)
+
+	stretch := running.latency.snapshot(10).Overall.Stretch
+	s.Equal(2, stretch.Count)
+	s.Equal(200, stretch.Max)
+}
+
+func (s *TestSuite) TestCapacityValidation() {
+	s.NoError(CapacityConfig{Limits: Resources{ResourceCPU: 100}, Contention: 0.5}.validate())
+	s.Error(CapacityConfig{Limits: Resources{ResourceCPU: -1}}.validate())
+	s.Error(CapacityConfig{Contention: -1}.validate())
+}
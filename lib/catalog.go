@@ -0,0 +1,317 @@
+package lib
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// catalogNamespace derives stable query IDs from the names of catalog entries without an ID
+var catalogNamespace = uuid.MustParse("6f2c8d8e-3b1a-4f7e-9c55-0c8f3e1d2a47")
+
+// catalogFields are the fields of a catalog entry other than its resources. In CSV, the resource
+// columns go between the profile and the probability.
+var catalogFields = []string{"id", "name", "profile", "probability", "priority", "duration", "shape", "max_latency", "tenant", "write"}
+
+// CatalogEntry is the serialized form of a query template and its arrival probability.
+// Its usage is written as one field or column per resource, alongside the others.
+type CatalogEntry struct {
+	ID          uuid.UUID  `json:"id"`
+	Name        string     `json:"name"`
+	Profile     Profile    `json:"profile"`
+	Usage       Resources  `json:"-"`
+	Probability float64    `json:"probability"`
+	Priority    Priority   `json:"priority"`
+	Duration    int        `json:"duration"`
+	Shape       UsageShape `json:"shape"`
+	MaxLatency  int        `json:"max_latency,omitempty"`
+	Tenant      string     `json:"tenant,omitempty"`
+	Write       bool       `json:"write,omitempty"`
+}
+
+// MarshalJSON writes the usage of the entry as one field per resource
+func (e CatalogEntry) MarshalJSON() ([]byte, error) {
+	type plain CatalogEntry
+	return marshalFlattened(e.Usage, e.Usage.names(), plain(e))
+}
+
+// UnmarshalJSON fills the optional fields of a catalog entry with their defaults before decoding.
+// Every field that is not one of catalogFields is the usage of a resource. A missing profile is
+// inferred from the usage the entry is bound by.
+func (e *CatalogEntry) UnmarshalJSON(data []byte) error {
+	type plain CatalogEntry
+	decoded := plain{Profile: -1, Priority: PriorityNormal, Duration: 1, Shape: FlatShape, Tenant: DefaultTenant}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	decoded.Usage = make(Resources)
+	for name, value := range fields {
+		if slices.Contains(catalogFields, name) {
+			continue
+		}
+		var usage int
+		if err := json.Unmarshal(value, &usage); err != nil {
+			return fmt.Errorf("invalid %s: %w", name, err)
+		}
+		decoded.Usage[name] = usage
+	}
+
+	*e = CatalogEntry(decoded)
+	if e.Profile < 0 {
+		e.Profile = inferProfile(e.Usage)
+	}
+	return nil
+}
+
+// newCatalog converts the query templates and their probabilities to catalog entries
+func newCatalog(queries []*Query, probs *[]float64) []CatalogEntry {
+	catalog := make([]CatalogEntry, len(queries))
+	for i, query := range queries {
+		catalog[i] = CatalogEntry{
+			ID:          query.id,
+			Name:        query.name,
+			Profile:     query.profile,
+			Usage:       query.usage.clone(),
+			Probability: (*probs)[i],
+			Priority:    query.priority,
+			Duration:    query.duration,
+			Shape:       query.shape,
+			MaxLatency:  query.maxLatency,
+			Tenant:      query.tenant,
+			Write:       query.write,
+		}
+	}
+	return catalog
+}
+
+// queriesFromCatalog converts catalog entries back to query templates and their probabilities.
+// Entries without an ID get one derived from their name, so it is stable across runs.
+func queriesFromCatalog(catalog []CatalogEntry) ([]*Query, *[]float64, error) {
+	if len(catalog) == 0 {
+		return nil, nil, fmt.Errorf("catalog is empty")
+	}
+
+	queries := make([]*Query, len(catalog))
+	probs := make([]float64, len(catalog))
+	seen := make(map[uuid.UUID]bool, len(catalog))
+	for i, entry := range catalog {
+		if entry.ID == uuid.Nil && entry.Name != "" {
+			entry.ID = uuid.NewSHA1(catalogNamespace, []byte(entry.Name))
+		}
+		if entry.ID == uuid.Nil || seen[entry.ID] {
+			return nil, nil, fmt.Errorf("catalog entry %d has a missing or duplicate id", i)
+		}
+		if entry.Probability < 0 {
+			return nil, nil, fmt.Errorf("catalog entry %s has a negative probability", entry.ID)
+		}
+		if entry.Duration < 1 {
+			return nil, nil, fmt.Errorf("catalog entry %s must have a duration of at least 1 tick", entry.ID)
+		}
+		if err := entry.Shape.validate(); err != nil {
+			return nil, nil, fmt.Errorf("catalog entry %s: %w", entry.ID, err)
+		}
+		seen[entry.ID] = true
+		queries[i] = &Query{
+			id:         entry.ID,
+			name:       entry.Name,
+			profile:    entry.Profile,
+			usage:      entry.Usage.clone(),
+			priority:   entry.Priority,
+			duration:   entry.Duration,
+			shape:      entry.Shape,
+			maxLatency: entry.MaxLatency,
+			tenant:     entry.Tenant,
+			write:      entry.Write,
+		}
+		probs[i] = entry.Probability
+	}
+	return queries, &probs, nil
+}
+
+// LoadCatalog reads a query catalog from a .csv or .json file
+func LoadCatalog(path string) ([]CatalogEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var catalog []CatalogEntry
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.NewDecoder(file).Decode(&catalog)
+	case ".csv":
+		catalog, err = readCatalogCSV(file)
+	default:
+		return nil, fmt.Errorf("catalog %s must be a .csv or .json file", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid catalog %s: %w", path, err)
+	}
+	return catalog, nil
+}
+
+// WriteCatalog writes a query catalog to a .csv or .json file, in the format LoadCatalog reads
+func WriteCatalog(path string, catalog []CatalogEntry) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(catalog)
+	case ".csv":
+		err = WriteCatalogCSV(file, catalog)
+	default:
+		return fmt.Errorf("catalog %s must be a .csv or .json file", path)
+	}
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// WriteCatalogCSV writes a query catalog as CSV, with a header row and a column for every resource any entry uses
+func WriteCatalogCSV(w io.Writer, catalog []CatalogEntry) error {
+	usages := make([]Resources, len(catalog))
+	for i, entry := range catalog {
+		usages[i] = entry.Usage
+	}
+	resources := resourceNames(usages...)
+
+	writer := csv.NewWriter(w)
+	writer.Write(slices.Concat(catalogFields[:3], resources, catalogFields[3:]))
+	for _, entry := range catalog {
+		record := []string{entry.ID.String(), entry.Name, entry.Profile.String()}
+		for _, resource := range resources {
+			record = append(record, strconv.Itoa(entry.Usage[resource]))
+		}
+		writer.Write(append(record,
+			strconv.FormatFloat(entry.Probability, 'g', -1, 64),
+			entry.Priority.String(),
+			strconv.Itoa(entry.Duration),
+			string(entry.Shape),
+			strconv.Itoa(entry.MaxLatency),
+			entry.Tenant,
+			strconv.FormatBool(entry.Write),
+		))
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// readCatalogCSV reads a CSV catalog with a header row. Columns may be in any order, and only
+// probability is required; the others take the same defaults as JSON. Every column that is not one
+// of catalogFields is the usage of a resource, so a catalog may leave out built-in resources its
+// templates do not use.
+func readCatalogCSV(r io.Reader) ([]CatalogEntry, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("missing header row")
+	}
+
+	columns := make(map[string]int)
+	for i, column := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+	if _, ok := columns["probability"]; !ok {
+		return nil, fmt.Errorf("missing probability column")
+	}
+
+	catalog := make([]CatalogEntry, 0, len(records)-1)
+	for line, record := range records[1:] {
+		entry, err := parseCatalogRecord(columns, record)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line+2, err)
+		}
+		catalog = append(catalog, entry)
+	}
+	return catalog, nil
+}
+
+func parseCatalogRecord(columns map[string]int, record []string) (CatalogEntry, error) {
+	entry := CatalogEntry{Usage: make(Resources), Priority: PriorityNormal, Duration: 1, Shape: FlatShape, Tenant: DefaultTenant}
+	field := func(column string) string {
+		if i, ok := columns[column]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var err error
+	if value := field("id"); value != "" {
+		if entry.ID, err = uuid.Parse(value); err != nil {
+			return entry, err
+		}
+	}
+	entry.Name = field("name")
+	for column := range columns {
+		if column == "" || slices.Contains(catalogFields, column) {
+			continue
+		}
+		usage, err := strconv.Atoi(field(column))
+		if err != nil {
+			return entry, fmt.Errorf("invalid %s: %w", column, err)
+		}
+		// Entries that do not use an extra resource leave it out, as they do in JSON
+		if usage != 0 || slices.Contains(builtinResources, column) {
+			entry.Usage[column] = usage
+		}
+	}
+	if entry.Probability, err = strconv.ParseFloat(field("probability"), 64); err != nil {
+		return entry, fmt.Errorf("invalid probability: %w", err)
+	}
+	if value := field("profile"); value != "" {
+		if err = entry.Profile.UnmarshalText([]byte(value)); err != nil {
+			return entry, err
+		}
+	} else {
+		entry.Profile = inferProfile(entry.Usage)
+	}
+	if value := field("priority"); value != "" {
+		if err = entry.Priority.UnmarshalText([]byte(value)); err != nil {
+			return entry, err
+		}
+	}
+	if value := field("duration"); value != "" {
+		if entry.Duration, err = strconv.Atoi(value); err != nil {
+			return entry, fmt.Errorf("invalid duration: %w", err)
+		}
+	}
+	if value := field("shape"); value != "" {
+		entry.Shape = UsageShape(value)
+	}
+	if value := field("tenant"); value != "" {
+		entry.Tenant = value
+	}
+	if value := field("write"); value != "" {
+		if entry.Write, err = strconv.ParseBool(value); err != nil {
+			return entry, fmt.Errorf("invalid write: %w", err)
+		}
+	}
+	if value := field("max_latency"); value != "" {
+		if entry.MaxLatency, err = strconv.Atoi(value); err != nil {
+			return entry, fmt.Errorf("invalid max_latency: %w", err)
+		}
+	}
+	return entry, nil
+}
@@ -0,0 +1,118 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func (s *TestSuite) TestCatalogRoundTrip() {
+	queries := getQueries(10)
+	probs := getExecutionProbs(10)
+	assignPriorities(queries, PriorityConfig{Weights: map[Priority]float64{PriorityLow: 1, PriorityNormal: 1, PriorityHigh: 1}}, processRand{})
+	queries[3].duration = 4
+	queries[5].maxLatency = 20
+	queries[7].usage["network"] = 12
+	catalog := newCatalog(queries, probs)
+
+	for _, ext := range []string{".json", ".csv"} {
+		path := filepath.Join(s.T().TempDir(), "catalog"+ext)
+		s.NoError(WriteCatalog(path, catalog))
+		loaded, err := LoadCatalog(path)
+		s.NoError(err, ext)
+		s.Equal(catalog, loaded, ext)
+	}
+}
+
+func (s *TestSuite) TestLoadCatalogDefaults() {
+	dir := s.T().TempDir()
+	csvPath := filepath.Join(dir, "catalog.csv")
+	s.NoError(os.WriteFile(csvPath, []byte("name,io,cpu,memory,probability\nreport,90,20,30,0.01\n"), 0644))
+	jsonPath := filepath.Join(dir, "catalog.json")
+	s.NoError(os.WriteFile(jsonPath, []byte(`[{"name":"report","cpu":20,"memory":30,"io":90,"probability":0.01}]`), 0644))
+
+	var ids []string
+	for _, path := range []string{csvPath, jsonPath} {
+		catalog, err := LoadCatalog(path)
+		s.NoError(err)
+		s.Len(catalog, 1)
+		s.Equal(IO, catalog[0].Profile)
+		s.Equal(PriorityNormal, catalog[0].Priority)
+		s.Equal(1, catalog[0].Duration)
+
+		queries, _, err := queriesFromCatalog(catalog)
+		s.NoError(err)
+		ids = append(ids, queries[0].id.String())
+	}
+	s.Equal(ids[0], ids[1])
+}
+
+func (s *TestSuite) TestLoadCatalogErrors() {
+	dir := s.T().TempDir()
+	for name, content := range map[string]string{
+		"missing.csv":  "name,cpu,memory\nreport,1,2\n",
+		"invalid.csv":  "cpu,memory,io,probability\n1,2,x,0.1\n",
+		"priority.csv": "cpu,memory,io,probability,priority\n1,2,3,0.1,urgent\n",
+		"catalog.yaml": "",
+	} {
+		path := filepath.Join(dir, name)
+		s.NoError(os.WriteFile(path, []byte(content), 0644))
+		_, err := LoadCatalog(path)
+		s.Error(err, name)
+	}
+
+	_, _, err := queriesFromCatalog([]CatalogEntry{{Usage: Resources{ResourceCPU: 1}, Duration: 1}})
+	s.Error(err)
+}
+
+func (s *TestSuite) TestWriteCatalogCSVHeader() {
+	var b strings.Builder
+	s.NoError(WriteCatalogCSV(&b, newCatalog(getQueries(1), getExecutionProbs(1))))
+	s.True(strings.HasPrefix(b.String(), "id,name,profile,cpu,memory,io,probability,priority,duration,shape,max_latency,tenant,write\n"))
+}
+
+func (s *TestSuite) TestInferProfile() {
+	s.Equal(CPU, inferProfile(Resources{ResourceCPU: 70, ResourceMemory: 30, ResourceIO: 30}))
+	s.Equal(Memory, inferProfile(Resources{ResourceCPU: 30, ResourceMemory: 70, ResourceIO: 30}))
+	s.Equal(IO, inferProfile(Resources{ResourceCPU: 30, ResourceMemory: 30, ResourceIO: 70, "network": 90}))
+}
+
+func (s *TestSuite) TestCatalogExtraResources() {
+	var entry CatalogEntry
+	s.NoError(entry.UnmarshalJSON([]byte(`{"name":"export","cpu":20,"memory":30,"io":40,"network":80,"probability":0.01}`)))
+	s.Equal(Resources{ResourceCPU: 20, ResourceMemory: 30, ResourceIO: 40, "network": 80}, entry.Usage)
+	s.Equal(IO, entry.Profile)
+
+	data, err := entry.MarshalJSON()
+	s.NoError(err)
+	s.True(strings.HasPrefix(string(data), `{"cpu":20,"memory":30,"io":40,"network":80,"id":`))
+
+	var b strings.Builder
+	s.NoError(WriteCatalogCSV(&b, []CatalogEntry{entry}))
+	s.True(strings.HasPrefix(b.String(), "id,name,profile,cpu,memory,io,network,probability,"))
+
+	s.Error(entry.UnmarshalJSON([]byte(`{"cpu":20,"memory":30,"io":40,"network":"high"}`)))
+}
+
+func (s *TestSuite) TestLoadCatalogCSVWithoutBuiltinResources() {
+	path := filepath.Join(s.T().TempDir(), "catalog.csv")
+	s.NoError(os.WriteFile(path, []byte("name,network,cpu,probability\nupload,80,10,0.01\n"), 0644))
+	catalog, err := LoadCatalog(path)
+	s.NoError(err)
+	s.Require().Len(catalog, 1)
+	s.Equal(Resources{"network": 80, ResourceCPU: 10}, catalog[0].Usage)
+	s.Equal(CPU, catalog[0].Profile)
+
+	var b strings.Builder
+	s.NoError(WriteCatalogCSV(&b, catalog))
+	s.True(strings.HasPrefix(b.String(), "id,name,profile,cpu,network,probability,"))
+}
+
+func (s *TestSuite) TestBoundResource() {
+	query := &Query{profile: IO, usage: Resources{ResourceCPU: 30, ResourceIO: 70, "network": 50, "gpu": 20}}
+	s.Equal(ResourceIO, query.boundResource())
+	query.usage["network"] = 90
+	s.Equal("network", query.boundResource())
+	query.usage["gpu"] = 95
+	s.Equal("gpu", query.boundResource())
+}
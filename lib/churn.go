@@ -0,0 +1,272 @@
+package lib
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// ChurnType is a change to the query catalog during a run
+type ChurnType string
+
+const (
+	ChurnDrift     ChurnType = "drift"     // a template's usage shifts, as when an index is dropped or the schema changes
+	ChurnRetire    ChurnType = "retire"    // a template stops arriving
+	ChurnIntroduce ChurnType = "introduce" // a new template starts arriving
+)
+
+// ChurnEvent is a catalog change scheduled for a given tick
+type ChurnEvent struct {
+	Tick        int                `json:"tick"`
+	Type        ChurnType          `json:"type"`
+	Query       string             `json:"query,omitempty"`       // Query is the name or ID of the template to drift or retire
+	Factors     map[string]float64 `json:"factors,omitempty"`     // Factors are what a drift scales the usage of each resource by, leaving the others unchanged
+	Profile     *Profile           `json:"profile,omitempty"`     // Profile is the profile of an introduced template, random if omitted
+	Probability float64            `json:"probability,omitempty"` // Probability is the arrival probability of an introduced template, the mean of the live ones if omitted
+}
+
+// ChurnConfig controls how the query catalog changes over a run
+type ChurnConfig struct {
+	Events        []ChurnEvent `json:"events"`         // Events are the changes scheduled for specific ticks
+	DriftRate     float64      `json:"drift_rate"`     // DriftRate is the chance per tick that a random template drifts
+	DriftSize     float64      `json:"drift_size"`     // DriftSize is the standard deviation of a random drift, relative to the usage
+	RetireRate    float64      `json:"retire_rate"`    // RetireRate is the chance per tick that a random template is retired
+	IntroduceRate float64      `json:"introduce_rate"` // IntroduceRate is the chance per tick that a new template is introduced
+	Log           string       `json:"log"`            // Log is a file every change is written to, otherwise it goes to the info log
+}
+
+func defaultChurnConfig() ChurnConfig {
+	return ChurnConfig{DriftSize: 0.5}
+}
+
+func (c ChurnConfig) validate() error {
+	for _, rate := range []float64{c.DriftRate, c.RetireRate, c.IntroduceRate} {
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("churn rates must be between 0 and 1")
+		}
+	}
+	if c.DriftSize < 0 {
+		return fmt.Errorf("churn drift_size must not be negative")
+	}
+	for _, event := range c.Events {
+		switch event.Type {
+		case ChurnDrift, ChurnRetire:
+			if event.Query == "" {
+				return fmt.Errorf("churn %s at tick %d needs a query", event.Type, event.Tick)
+			}
+		case ChurnIntroduce:
+		default:
+			return fmt.Errorf("unknown churn type %q", event.Type)
+		}
+		if event.Probability < 0 {
+			return fmt.Errorf("churn %s at tick %d must not have a negative probability", event.Type, event.Tick)
+		}
+		for _, factor := range event.Factors {
+			if factor < 0 {
+				return fmt.Errorf("churn %s at tick %d must not have negative factors", event.Type, event.Tick)
+			}
+		}
+	}
+	return nil
+}
+
+// validateFactors checks that drifts only scale resources queries can use, so that a misspelt
+// resource is not silently added to a template's usage
+func (c ChurnConfig) validateFactors(resources []string) error {
+	for _, event := range c.Events {
+		for name := range event.Factors {
+			if !slices.Contains(resources, name) {
+				return fmt.Errorf("churn %s at tick %d scales unknown resource %q", event.Type, event.Tick, name)
+			}
+		}
+	}
+	return nil
+}
+
+// enabled reports whether the catalog changes at all
+func (c ChurnConfig) enabled() bool {
+	return len(c.Events) > 0 || c.DriftRate > 0 || c.RetireRate > 0 || c.IntroduceRate > 0
+}
+
+// churn changes the query catalog of a queue as the run goes on
+type churn struct {
+	cfg       ChurnConfig
+	resources []ResourceConfig     // resources are the extra resources introduced templates use
+	tenants   []TenantConfig       // tenants are the tenants introduced templates are assigned to
+	scheduled map[int][]ChurnEvent // scheduled maps ticks to the events due on them
+	logger    zerolog.Logger
+	toFile    bool // toFile is set when changes go to their own file, which ignores the global log level
+}
+
+func newChurn(cfg ChurnConfig) (*churn, error) {
+	c := &churn{cfg: cfg, scheduled: make(map[int][]ChurnEvent), logger: log.Logger}
+	for _, event := range cfg.Events {
+		c.scheduled[event.Tick] = append(c.scheduled[event.Tick], event)
+	}
+	if cfg.Log != "" {
+		file, err := os.OpenFile(cfg.Log, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+		c.logger = zerolog.New(file).With().Timestamp().Logger()
+		c.toFile = true
+	}
+	return c, nil
+}
+
+// apply makes the changes due on the queue's current tick, both scheduled and random
+func (c *churn) apply(q *Queue) {
+	for _, event := range c.scheduled[q.ticks] {
+		if err := c.applyEvent(q, event); err != nil {
+			log.Err(err).Int("Tick", q.ticks).Msg("Skipping churn event")
+		}
+	}
+	delete(c.scheduled, q.ticks)
+
+	if c.cfg.DriftRate > 0 && q.rng.Float64() < c.cfg.DriftRate {
+		if query, _ := randomLive(q); query != nil {
+			factors := make(map[string]float64, len(query.usage))
+			for _, name := range query.usage.names() {
+				factors[name] = c.randomFactor(q.rng)
+			}
+			c.drift(q, query, factors)
+		}
+	}
+	if c.cfg.RetireRate > 0 && q.rng.Float64() < c.cfg.RetireRate {
+		// Random retirement always leaves at least one template arriving
+		if query, live := randomLive(q); live > 1 {
+			c.retire(q, query)
+		}
+	}
+	if c.cfg.IntroduceRate > 0 && q.rng.Float64() < c.cfg.IntroduceRate {
+		c.introduce(q, Profile(q.rng.Intn(3)), 0)
+	}
+}
+
+func (c *churn) applyEvent(q *Queue, event ChurnEvent) error {
+	if event.Type == ChurnIntroduce {
+		profile := Profile(q.rng.Intn(3))
+		if event.Profile != nil {
+			profile = *event.Profile
+		}
+		c.introduce(q, profile, event.Probability)
+		return nil
+	}
+
+	query := findQuery(q.queries, event.Query)
+	if query == nil {
+		return fmt.Errorf("churn %s references unknown query %q", event.Type, event.Query)
+	}
+	if event.Type == ChurnRetire {
+		c.retire(q, query)
+		return nil
+	}
+	c.drift(q, query, event.Factors)
+	return nil
+}
+
+// drift scales the usage of the template by the given factors, leaving resources without one unchanged
+func (c *churn) drift(q *Queue, query *Query, factors map[string]float64) {
+	q.catalogMu.Lock()
+	for name, factor := range factors {
+		query.usage[name] = int(math.Round(float64(query.usage[name]) * factor))
+	}
+	query.profile = inferProfile(query.usage)
+	q.catalogMu.Unlock()
+	c.record(q, EventDrifted, query)
+}
+
+// retire stops the template from arriving. It stays in the catalog, so executions already queued still run.
+func (c *churn) retire(q *Queue, query *Query) {
+	q.catalogMu.Lock()
+	for i, candidate := range q.queries {
+		if candidate == query {
+			(*q.probs)[i] = 0
+		}
+	}
+	q.catalogMu.Unlock()
+	c.record(q, EventRetired, query)
+}
+
+// introduce adds a new template to the catalog. A probability of 0 uses the mean of the live templates.
+func (c *churn) introduce(q *Queue, profile Profile, probability float64) {
+	if probability == 0 {
+		probability = meanLiveProbability(*q.probs)
+	}
+	query := drawQuery(q.rng, profile)
+	assignResources([]*Query{query}, c.resources, q.rng)
+	assignTenants([]*Query{query}, c.tenants, q.rng)
+	q.catalogMu.Lock()
+	query.name = fmt.Sprintf("%s-%d", query.profile, len(q.queries))
+	q.queries = append(q.queries, query)
+	*q.probs = append(*q.probs, probability)
+	q.catalogMu.Unlock()
+	c.record(q, EventIntroduced, query)
+}
+
+// record emits the change as a queue event and logs the template's usage after it
+func (c *churn) record(q *Queue, eventType EventType, query *Query) {
+	q.events = append(q.events, newQueryEvent(eventType, q.ticks, query))
+
+	event := c.logger.Info()
+	if c.toFile {
+		event = c.logger.Log()
+	}
+	event.
+		Str("Type", string(eventType)).
+		Int("Tick", q.ticks).
+		Str("Query", query.id.String()).
+		Str("Name", query.name).
+		Str("Profile", query.profile.String()).
+		Object("Usage", query.usage).
+		Msg("Catalog change")
+}
+
+// randomFactor draws a drift factor around 1, never below 0
+func (c *churn) randomFactor(rng randSource) float64 {
+	return math.Max(0.01, 1+c.cfg.DriftSize*rng.NormFloat64())
+}
+
+// findQuery returns the template with the given name or ID
+func findQuery(queries []*Query, ref string) *Query {
+	id, err := uuid.Parse(ref)
+	for _, query := range queries {
+		if query.name == ref || (err == nil && query.id == id) {
+			return query
+		}
+	}
+	return nil
+}
+
+// randomLive returns a random template that still arrives, or nil if there is none, and the number that do
+func randomLive(q *Queue) (*Query, int) {
+	live := make([]*Query, 0, len(q.queries))
+	for i, query := range q.queries {
+		if (*q.probs)[i] > 0 {
+			live = append(live, query)
+		}
+	}
+	if len(live) == 0 {
+		return nil, 0
+	}
+	return live[q.rng.Intn(len(live))], len(live)
+}
+
+func meanLiveProbability(probs []float64) float64 {
+	sum, live := 0.0, 0
+	for _, prob := range probs {
+		if prob > 0 {
+			sum += prob
+			live++
+		}
+	}
+	if live == 0 {
+		return 0.1
+	}
+	return sum / float64(live)
+}
@@ -0,0 +1,118 @@
+package lib
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+func (s *TestSuite) TestChurnScheduledEvents() {
+	queries := getQueries(3)
+	probs := []float64{0.5, 0.5, 0.5}
+	queue := newQueue(queries, &probs, 1)
+	memory := Memory
+	queue.churn = &churn{
+		scheduled: map[int][]ChurnEvent{
+			2: {{Tick: 2, Type: ChurnDrift, Query: queries[0].name, Factors: map[string]float64{ResourceCPU: 2}}},
+			3: {{Tick: 3, Type: ChurnRetire, Query: queries[1].id.String()}},
+			4: {{Tick: 4, Type: ChurnIntroduce, Profile: &memory, Probability: 0.25}},
+		},
+		logger: zerolog.Nop(),
+	}
+	cpu, io := queries[0].usage[ResourceCPU], queries[0].usage[ResourceIO]
+
+	queue.tick(1)
+	s.Empty(queue.drainEvents())
+
+	queue.tick(1)
+	events := queue.drainEvents()
+	s.Len(events, 1)
+	s.Equal(EventDrifted, events[0].Type)
+	s.Equal(queries[0].id.String(), events[0].Query)
+	s.Equal(cpu*2, queries[0].usage[ResourceCPU])
+	s.Equal(io, queries[0].usage[ResourceIO])
+
+	queue.tick(1)
+	events = queue.drainEvents()
+	s.Len(events, 1)
+	s.Equal(EventRetired, events[0].Type)
+	s.Equal(0.0, probs[1])
+
+	queue.tick(1)
+	events = queue.drainEvents()
+	s.Len(events, 1)
+	s.Equal(EventIntroduced, events[0].Type)
+	s.Len(queue.queries, 4)
+	s.Equal(Memory, queue.queries[3].profile)
+	s.Equal(0.25, (*queue.probs)[3])
+	s.Len(queue.getCatalog(), 4)
+}
+
+func (s *TestSuite) TestChurnRetiredQueryStopsArriving() {
+	queries := getQueries(2)
+	probs := []float64{1, 1}
+	queue := newQueue(queries, &probs, 1)
+	queue.churn = &churn{
+		scheduled: map[int][]ChurnEvent{1: {{Type: ChurnRetire, Query: queries[0].name}}},
+		logger:    zerolog.Nop(),
+	}
+
+	for i := 0; i < 50; i++ {
+		arrived, _ := queue.tick(1)
+		for _, execution := range arrived {
+			s.Equal(queries[1], execution.query)
+		}
+	}
+}
+
+func (s *TestSuite) TestChurnRandomRetireKeepsOneLive() {
+	queries := getQueries(5)
+	probs := getExecutionProbs(5)
+	queue := newQueue(queries, probs, 1)
+	queue.churn = &churn{cfg: ChurnConfig{RetireRate: 1}, scheduled: map[int][]ChurnEvent{}, logger: zerolog.Nop()}
+
+	for i := 0; i < 20; i++ {
+		queue.tick(1)
+	}
+	_, live := randomLive(queue)
+	s.Equal(1, live)
+	s.Len(queue.drainEvents(), 4)
+}
+
+func (s *TestSuite) TestChurnLog() {
+	var buf strings.Builder
+	queries := getQueries(1)
+	probs := []float64{0.5}
+	queue := newQueue(queries, &probs, 1)
+	c := &churn{logger: zerolog.New(&buf), toFile: true}
+	c.drift(queue, queries[0], map[string]float64{ResourceIO: 3})
+
+	var entry map[string]any
+	s.NoError(json.Unmarshal([]byte(buf.String()), &entry))
+	s.Equal(string(EventDrifted), entry["Type"])
+	s.Equal(queries[0].name, entry["Name"])
+	s.Equal(float64(queries[0].usage[ResourceIO]), entry["Usage"].(map[string]any)[ResourceIO])
+}
+
+func (s *TestSuite) TestChurnConfigValidation() {
+	s.NoError(defaultChurnConfig().validate())
+	s.Error(ChurnConfig{DriftRate: 2}.validate())
+	s.Error(ChurnConfig{Events: []ChurnEvent{{Type: ChurnRetire}}}.validate())
+	s.Error(ChurnConfig{Events: []ChurnEvent{{Type: "rename", Query: "cpu-0"}}}.validate())
+
+	cfg := DefaultConfig()
+	cfg.Churn.IntroduceRate = 0.01
+	cfg.Trace.Record = "trace.ndjson"
+	s.NoError(cfg.validate())
+
+	// Drifts may only scale resources the queries can use
+	cfg = DefaultConfig()
+	cfg.Resources = []ResourceConfig{{Name: "network", Mean: 20}}
+	cfg.Churn.Events = []ChurnEvent{{Tick: 5, Type: ChurnDrift, Query: "cpu-0", Factors: map[string]float64{"io": 2, "network": 3}}}
+	_, err := NewDBWithConfig(cfg)
+	s.NoError(err)
+	cfg.Churn.Events[0].Factors["netwrok"] = 3
+	_, err = NewDBWithConfig(cfg)
+	s.ErrorContains(err, `unknown resource "netwrok"`)
+}
@@ -0,0 +1,317 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrNodeNotFound   = errors.New("node not found")
+	ErrWriteOnReplica = errors.New("writes and maintenance tasks must run on the primary")
+)
+
+// PrimaryNode is the name of the node of a cluster that runs the writes
+const PrimaryNode = "primary"
+
+// Names of the built-in routers
+const (
+	RoundRobinRouter  = "round_robin"
+	LeastLoadedRouter = "least_loaded"
+	ProfileRouter     = "profile"
+)
+
+// ClusterConfig spreads the executions over a primary and read replicas, each running its
+// executions with its own capacity. The queue, the scheduler and the budget stay shared.
+type ClusterConfig struct {
+	Replicas int     `json:"replicas"` // Replicas is the number of read replicas, 0 for a single node
+	Routing  string  `json:"routing"`  // Routing is the name of the registered Router placing the reads on the nodes
+	Writes   float64 `json:"writes"`   // Writes is the share of generated query templates that write, which run on the primary
+}
+
+func defaultClusterConfig() ClusterConfig {
+	return ClusterConfig{Routing: RoundRobinRouter, Writes: 0.2}
+}
+
+func (c ClusterConfig) validate() error {
+	if c.Replicas < 0 {
+		return fmt.Errorf("cluster replicas must not be negative")
+	}
+	if c.Writes < 0 || c.Writes > 1 {
+		return fmt.Errorf("cluster writes must be between 0 and 1")
+	}
+	routersMu.RLock()
+	_, ok := routers[c.Routing]
+	routersMu.RUnlock()
+	if !ok {
+		return fmt.Errorf("unknown router %q", c.Routing)
+	}
+	return nil
+}
+
+func (c ClusterConfig) enabled() bool {
+	return c.Replicas > 0
+}
+
+// assignWrites draws which generated queries write, with the configured share
+func assignWrites(queries []*Query, share float64, rng randSource) {
+	for _, query := range queries {
+		query.write = rng.Float64() < share
+	}
+}
+
+// Router places every read arriving on a node of the cluster. It is given the nodes with the
+// primary first, and returns the index of the node the execution runs on. Writes and
+// maintenance tasks always run on the primary and are not routed.
+type Router interface {
+	Route(execution *Execution, nodes []NodeLoad) int
+}
+
+// NodeLoad is a node of the cluster as seen by a Router
+type NodeLoad struct {
+	Name     string
+	Primary  bool
+	InFlight Resources // InFlight is the demand of the executions running on the node
+	Queued   Resources // Queued is the usage of the executions queued to run on the node
+}
+
+// total is the sum of the usage in flight and queued over every resource
+func (n NodeLoad) total() int {
+	total := 0
+	for _, usage := range n.InFlight {
+		total += usage
+	}
+	for _, usage := range n.Queued {
+		total += usage
+	}
+	return total
+}
+
+var (
+	routersMu sync.RWMutex // routersMu guards routers, so a router can be registered while databases are created
+	routers   = map[string]func() Router{
+		RoundRobinRouter:  func() Router { return &roundRobinRouter{} },
+		LeastLoadedRouter: func() Router { return leastLoadedRouter{} },
+		ProfileRouter:     func() Router { return profileRouter{} },
+	}
+)
+
+// RegisterRouter makes a router selectable by name through Config.Cluster.Routing. It is safe to
+// call concurrently with creating databases.
+func RegisterRouter(name string, factory func() Router) {
+	routersMu.Lock()
+	defer routersMu.Unlock()
+	routers[name] = factory
+}
+
+func newRouter(name string) (Router, error) {
+	routersMu.RLock()
+	factory, ok := routers[name]
+	routersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown router %q", name)
+	}
+	return factory(), nil
+}
+
+// roundRobinRouter places the reads on the replicas in turn
+type roundRobinRouter struct {
+	next int
+}
+
+func (r *roundRobinRouter) Route(execution *Execution, nodes []NodeLoad) int {
+	node := 1 + r.next%(len(nodes)-1)
+	r.next++
+	return node
+}
+
+// leastLoadedRouter places each read on the replica with the least usage in flight and queued
+type leastLoadedRouter struct{}
+
+func (leastLoadedRouter) Route(execution *Execution, nodes []NodeLoad) int {
+	return leastLoaded(nodes, NodeLoad.total)
+}
+
+// profileRouter places each read on the replica with the least usage in flight and queued of the
+// resource the query is bound by, so that queries bound by different resources share a replica.
+// That is an extra resource rather than the query's profile if the query uses more of it.
+type profileRouter struct{}
+
+func (profileRouter) Route(execution *Execution, nodes []NodeLoad) int {
+	resource := execution.query.boundResource()
+	return leastLoaded(nodes, func(n NodeLoad) int {
+		return n.InFlight[resource] + n.Queued[resource]
+	})
+}
+
+// leastLoaded returns the index of the replica with the lowest load, the first of them on a tie
+func leastLoaded(nodes []NodeLoad, load func(NodeLoad) int) int {
+	best, lowest := 1, math.MaxInt
+	for i := 1; i < len(nodes); i++ {
+		if l := load(nodes[i]); l < lowest {
+			best, lowest = i, l
+		}
+	}
+	return best
+}
+
+// node is a member of the cluster, running its executions and reporting their usage to its own monitor
+type node struct {
+	name    string
+	running *runSet
+	monitor *Monitor
+	updates chan ResourceUpdate
+}
+
+// cluster holds the nodes executions run on, the primary first
+type cluster struct {
+	nodes  []*node
+	router Router
+}
+
+// NodeMetrics is the resource utilization of a node of the cluster
+type NodeMetrics struct {
+	Name      string           `json:"name"`
+	Primary   bool             `json:"primary"`
+	Resources *ResourceMetrics `json:"resources"`
+}
+
+func newCluster(cfg ClusterConfig, newNode func(name string) *node) (*cluster, error) {
+	router, err := newRouter(cfg.Routing)
+	if err != nil {
+		return nil, err
+	}
+	c := &cluster{router: router}
+	c.nodes = append(c.nodes, newNode(PrimaryNode))
+	for i := 1; i <= cfg.Replicas; i++ {
+		c.nodes = append(c.nodes, newNode(fmt.Sprintf("replica-%d", i)))
+	}
+	return c, nil
+}
+
+// pinned reports whether the execution must run on the primary
+func pinned(execution *Execution) bool {
+	return execution.query.write || execution.kind == KindMaintenance
+}
+
+// route places the arrivals on the nodes, given the executions already queued
+func (c *cluster) route(arrivals []*Execution, queued map[uuid.UUID]*Execution) {
+	loads := make([]NodeLoad, len(c.nodes))
+	for i, node := range c.nodes {
+		loads[i] = NodeLoad{Name: node.name, Primary: i == 0, InFlight: node.running.usage(), Queued: make(Resources)}
+	}
+	for _, execution := range queued {
+		loads[execution.node].Queued.add(execution.usage, 1)
+	}
+	for _, execution := range arrivals {
+		execution.node = 0
+		if !pinned(execution) {
+			if i := c.router.Route(execution, loads); i >= 0 && i < len(c.nodes) {
+				execution.node = i
+			}
+		}
+		loads[execution.node].Queued.add(execution.usage, 1)
+	}
+}
+
+// find returns the index of the named node
+func (c *cluster) find(name string) (int, bool) {
+	for i, node := range c.nodes {
+		if node.name == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// usage sums the demand in flight on every node
+func (c *cluster) usage() Resources {
+	usage := make(Resources)
+	for _, node := range c.nodes {
+		usage.add(node.running.usage(), 1)
+	}
+	return usage
+}
+
+// tick starts the executions run this tick on their nodes and advances every node. It returns the
+// usage of the whole cluster, and that of each node for publish, which is called once the queue is
+// unlocked so that a slow monitor does not hold up the API.
+func (c *cluster) tick(executed []*Execution, now int) (ResourceUpdate, []ResourceUpdate) {
+	started := make([][]*Execution, len(c.nodes))
+	for _, execution := range executed {
+		started[execution.node] = append(started[execution.node], execution)
+	}
+	total := ResourceUpdate{Usage: make(Resources)}
+	updates := make([]ResourceUpdate, len(c.nodes))
+	for i, node := range c.nodes {
+		node.running.start(started[i])
+		node.running.now = now
+		updates[i] = node.running.tick()
+		total.merge(updates[i])
+	}
+	return total, updates
+}
+
+// publish reports the usage of each node returned by tick to its monitor
+func (c *cluster) publish(updates []ResourceUpdate) {
+	for i, node := range c.nodes {
+		node.updates <- updates[i]
+	}
+}
+
+// merge adds the usage of another update to this one
+func (u *ResourceUpdate) merge(other ResourceUpdate) {
+	u.Usage.add(other.Usage, 1)
+	u.Running += other.Running
+	u.Throttled += other.Throttled
+	if other.Tenants == nil {
+		return
+	}
+	if u.Tenants == nil {
+		u.Tenants = make(map[string]Resources)
+	}
+	for tenant, usage := range other.Tenants {
+		if u.Tenants[tenant] == nil {
+			u.Tenants[tenant] = make(Resources)
+		}
+		u.Tenants[tenant].add(usage, 1)
+	}
+}
+
+// reroute moves a queued execution to the named node, overriding the router
+func (q *Queue) reroute(id uuid.UUID, name string) error {
+	_, err := q.rerouteWithSchedule(id, name)
+	return err
+}
+
+// rerouteWithSchedule applies reroute and returns the schedule of the execution around it
+func (q *Queue) rerouteWithSchedule(id uuid.UUID, name string) (Schedule, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	schedule := Schedule{Before: q.dueAt(id)}
+	err := q.moveTo(id, name)
+	schedule.After = q.dueAt(id)
+	return schedule, err
+}
+
+func (q *Queue) moveTo(id uuid.UUID, name string) error {
+	execution, ok := q.queued[id]
+	if !ok {
+		return ErrExecutionNotFound
+	}
+	if q.cluster == nil {
+		return ErrNodeNotFound
+	}
+	i, ok := q.cluster.find(name)
+	if !ok {
+		return ErrNodeNotFound
+	}
+	if i != 0 && pinned(execution) {
+		return ErrWriteOnReplica
+	}
+	execution.node = i
+	return nil
+}
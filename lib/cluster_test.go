@@ -0,0 +1,143 @@
+package lib
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// testCluster builds a cluster of a primary and the given number of replicas
+func testCluster(replicas int, routing string) *cluster {
+	c, _ := newCluster(ClusterConfig{Replicas: replicas, Routing: routing}, func(name string) *node {
+		return &node{name: name, running: newRunSet(), monitor: newMonitor(time.Second, 10, builtinResources), updates: make(chan ResourceUpdate, 100)}
+	})
+	return c
+}
+
+func (s *TestSuite) TestRoundRobinRouting() {
+	c := testCluster(2, RoundRobinRouter)
+	read, write := getQuery(CPU), getQuery(CPU)
+	write.write = true
+	arrivals := []*Execution{
+		newExecution(read, uuid.New(), 1),
+		newExecution(write, uuid.New(), 1),
+		newExecution(read, uuid.New(), 1),
+		newExecution(read, uuid.New(), 1),
+	}
+	maintenance := newExecution(read, uuid.New(), 1)
+	maintenance.kind = KindMaintenance
+	arrivals = append(arrivals, maintenance)
+
+	c.route(arrivals, map[uuid.UUID]*Execution{})
+	nodes := make([]int, len(arrivals))
+	for i, execution := range arrivals {
+		nodes[i] = execution.node
+	}
+	s.Equal([]int{1, 0, 2, 1, 0}, nodes)
+}
+
+func (s *TestSuite) TestLoadAwareRouting() {
+	cpu, io := getQuery(CPU), getQuery(IO)
+	cpu.usage = Resources{ResourceCPU: 50, ResourceIO: 10}
+	io.usage = Resources{ResourceCPU: 10, ResourceIO: 50}
+	busy := newExecution(cpu, uuid.New(), 1)
+	busy.node = 1
+	queued := map[uuid.UUID]*Execution{busy.id: busy}
+
+	// Replica 1 has the most load in total, but the least IO
+	c := testCluster(2, LeastLoadedRouter)
+	c.nodes[2].running.start([]*Execution{{query: io, duration: 5, usage: Resources{ResourceIO: 45}}})
+	execution := newExecution(io, uuid.New(), 1)
+	c.route([]*Execution{execution}, queued)
+	s.Equal(2, execution.node)
+
+	c.router = profileRouter{}
+	execution = newExecution(io, uuid.New(), 1)
+	c.route([]*Execution{execution}, queued)
+	s.Equal(1, execution.node)
+
+	// A query bound by an extra resource is routed on that rather than on its profile
+	upload := getQuery(IO)
+	upload.usage = Resources{ResourceIO: 10, "network": 50}
+	c.nodes[1].running.start([]*Execution{{query: upload, duration: 5, usage: Resources{"network": 40}}})
+	execution = newExecution(upload, uuid.New(), 1)
+	c.route([]*Execution{execution}, queued)
+	s.Equal(2, execution.node)
+}
+
+func (s *TestSuite) TestReroute() {
+	read, write := getQuery(CPU), getQuery(CPU)
+	write.write = true
+	queue := newQueue([]*Query{read, write}, &[]float64{0, 0}, 1)
+	reads, writes := newExecution(read, uuid.New(), 1), newExecution(write, uuid.New(), 1)
+	queue.queued[reads.id] = reads
+	queue.queued[writes.id] = writes
+	s.ErrorIs(queue.reroute(reads.id, "replica-1"), ErrNodeNotFound)
+
+	queue.cluster = testCluster(2, RoundRobinRouter)
+	s.NoError(queue.reroute(reads.id, "replica-2"))
+	s.Equal(2, reads.node)
+	s.ErrorIs(queue.reroute(reads.id, "replica-3"), ErrNodeNotFound)
+	s.ErrorIs(queue.reroute(writes.id, "replica-1"), ErrWriteOnReplica)
+	s.NoError(queue.reroute(writes.id, PrimaryNode))
+	s.ErrorIs(queue.reroute(uuid.New(), PrimaryNode), ErrExecutionNotFound)
+}
+
+func (s *TestSuite) TestClusterTick() {
+	c := testCluster(1, RoundRobinRouter)
+	query := getQuery(CPU)
+	primary := &Execution{query: query, duration: 1, usage: Resources{ResourceCPU: 10}}
+	replica := &Execution{query: query, duration: 2, usage: Resources{ResourceCPU: 7}, node: 1}
+
+	update, updates := c.tick([]*Execution{primary, replica}, 1)
+	s.Equal(Resources{ResourceCPU: 17}, update.Usage)
+	s.Equal(2, update.Running)
+
+	// Nothing is sent to the monitors until the queue is unlocked and the updates are published
+	s.Empty(c.nodes[0].updates)
+	c.publish(updates)
+	s.Equal(Resources{ResourceCPU: 10}, (<-c.nodes[0].updates).Usage)
+	s.Equal(Resources{ResourceCPU: 7}, (<-c.nodes[1].updates).Usage)
+	s.Equal(Resources{ResourceCPU: 7}, c.usage())
+}
+
+func (s *TestSuite) TestClusterConfig() {
+	cfg := DefaultConfig()
+	s.NoError(cfg.validate())
+	cfg.Cluster.Routing = "random"
+	s.Error(cfg.validate())
+	cfg.Cluster = ClusterConfig{Replicas: -1, Routing: RoundRobinRouter}
+	s.Error(cfg.validate())
+
+	cfg.Cluster = ClusterConfig{Replicas: 2, Routing: ProfileRouter, Writes: 1}
+	db, err := NewDBWithConfig(cfg)
+	s.NoError(err)
+	s.Len(db.GetNodes(), 3)
+	for _, entry := range db.GetCatalog() {
+		s.True(entry.Write)
+	}
+}
+
+func (s *TestSuite) TestRegisterRouter() {
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			RegisterRouter(fmt.Sprintf("primary-%d", i), func() Router { return leastLoadedRouter{} })
+		}()
+		go func() {
+			defer wg.Done()
+			s.NoError(ClusterConfig{Routing: RoundRobinRouter}.validate())
+			_, err := newRouter(RoundRobinRouter)
+			s.NoError(err)
+		}()
+	}
+	wg.Wait()
+
+	router, err := newRouter("primary-3")
+	s.NoError(err)
+	s.IsType(leastLoadedRouter{}, router)
+}
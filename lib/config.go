@@ -0,0 +1,162 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Config holds the tunable parameters of the simulated database
+type Config struct {
+	Queries         int                `json:"queries"`          // Queries is the number of query templates generated
+	Seed            int64              `json:"seed"`             // Seed makes the generated query templates the same on every run, 0 for new ones each run
+	DefaultDelay    int                `json:"default_delay"`    // DefaultDelay is the default delay of a query in ticks
+	Tickrate        int                `json:"tickrate"`         // Tickrate is the number of ticks per second
+	MetricsInterval int                `json:"metrics_interval"` // MetricsInterval is the metrics update frequency in milliseconds
+	Scheduler       string             `json:"scheduler"`        // Scheduler is the name of the registered Scheduler consulted on every tick
+	Resources       []ResourceConfig   `json:"resources"`        // Resources are the resources queries use beyond CPU, memory and IO
+	Budget          Budget             `json:"budget"`           // Budget caps the resources run per tick, with the overflow carried to the next tick
+	Capacity        CapacityConfig     `json:"capacity"`         // Capacity slows executions down when the demand in flight exceeds it
+	Semantics       SemanticsConfig    `json:"semantics"`        // Semantics is whether each resource is instant, held while running or throughput
+	Cache           CacheConfig        `json:"cache"`            // Cache makes repeat executions of a query cheaper while its result is cached
+	Priorities      PriorityConfig     `json:"priorities"`       // Priorities controls query priorities and their delay ceilings
+	Deadlines       DeadlineConfig     `json:"deadlines"`        // Deadlines bounds how long an execution may stay queued
+	Backpressure    BackpressureConfig `json:"backpressure"`     // Backpressure bounds how many executions may stay queued and sheds the rest
+	Arrivals        ArrivalConfig      `json:"arrivals"`         // Arrivals selects the model that decides which queries arrive on each tick
+	Curve           CurveConfig        `json:"curve"`            // Curve is the load curve scaling the arrival rate over time
+	Trace           TraceConfig        `json:"trace"`            // Trace controls recording arrivals to a trace and replaying them
+	Durations       DurationConfig     `json:"durations"`        // Durations controls how many ticks executions run for and how their usage is spread
+	Noise           NoiseConfig        `json:"noise"`            // Noise controls how much each execution's usage varies around its query's usage
+	Churn           ChurnConfig        `json:"churn"`            // Churn drifts, retires and introduces query templates over the run
+	Recurring       []RecurringJob     `json:"recurring"`        // Recurring are jobs that arrive on a schedule on top of the random arrivals
+	Maintenance     MaintenanceConfig  `json:"maintenance"`      // Maintenance generates background tasks that must finish within a window
+	Groups          []GroupConfig      `json:"groups"`           // Groups are chains and transactions of queries that arrive together
+	Tenants         []TenantConfig     `json:"tenants"`          // Tenants are the customers owning the query templates, each with a delay quota
+	History         HistoryConfig      `json:"history"`          // History keeps the lifecycle of recent executions for debugging
+	Cluster         ClusterConfig      `json:"cluster"`          // Cluster spreads the executions over a primary and read replicas
+	Catalog         string             `json:"catalog"`          // Catalog is a .csv or .json file to load the query templates from instead of generating them
+	ExportCatalog   string             `json:"export_catalog"`   // ExportCatalog is a .csv or .json file the query templates are written to on startup
+}
+
+// DefaultConfig returns the configuration used by NewDB
+func DefaultConfig() Config {
+	return Config{
+		Queries:         100,  // 100 dummy queries
+		DefaultDelay:    1,    // 1 tick / 100ms default delay
+		Tickrate:        10,   // 10 ticks per second
+		MetricsInterval: 1000, // 1 second metrics update frequency
+		Scheduler:       FIFOScheduler,
+		Priorities:      defaultPriorityConfig(),
+		Deadlines:       defaultDeadlineConfig(),
+		Backpressure:    defaultBackpressureConfig(),
+		Arrivals:        defaultArrivalConfig(),
+		Curve:           defaultCurveConfig(),
+		Trace:           defaultTraceConfig(),
+		Durations:       defaultDurationConfig(),
+		Noise:           defaultNoiseConfig(),
+		Semantics:       defaultSemanticsConfig(),
+		Cache:           defaultCacheConfig(),
+		Churn:           defaultChurnConfig(),
+		Maintenance:     defaultMaintenanceConfig(),
+		History:         defaultHistoryConfig(),
+		Cluster:         defaultClusterConfig(),
+	}
+}
+
+// LoadConfig reads a JSON config file, falling back to DefaultConfig for any omitted field
+func LoadConfig(path string) (Config, error) {
+	cfg := DefaultConfig()
+	file, err := os.Open(path)
+	if err != nil {
+		return cfg, err
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&cfg); err != nil {
+		return cfg, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return cfg, cfg.validate()
+}
+
+func (c Config) validate() error {
+	if c.Queries <= 0 {
+		return fmt.Errorf("queries must be positive")
+	}
+	if c.DefaultDelay < 0 {
+		return fmt.Errorf("default_delay must not be negative")
+	}
+	if c.Tickrate <= 0 || c.Tickrate > 1000 {
+		return fmt.Errorf("tickrate must be between 1 and 1000")
+	}
+	if c.MetricsInterval <= 0 {
+		return fmt.Errorf("metrics_interval must be positive")
+	}
+	if err := validateResources(c.Resources); err != nil {
+		return err
+	}
+	if err := c.Budget.validate(); err != nil {
+		return err
+	}
+	if err := c.Capacity.validate(); err != nil {
+		return err
+	}
+	if err := c.Semantics.validate(); err != nil {
+		return err
+	}
+	if err := c.Cache.validate(); err != nil {
+		return err
+	}
+	if err := c.Priorities.validate(); err != nil {
+		return err
+	}
+	if err := c.Deadlines.validate(); err != nil {
+		return err
+	}
+	if err := c.Backpressure.validate(); err != nil {
+		return err
+	}
+	if err := c.Arrivals.validate(); err != nil {
+		return err
+	}
+	if err := c.Trace.validate(); err != nil {
+		return err
+	}
+	if err := c.Durations.validate(); err != nil {
+		return err
+	}
+	if err := c.Noise.validate(); err != nil {
+		return err
+	}
+	if err := c.Churn.validate(); err != nil {
+		return err
+	}
+	if err := validateRecurringJobs(c.Recurring); err != nil {
+		return err
+	}
+	if err := c.Maintenance.validate(); err != nil {
+		return err
+	}
+	if err := validateGroups(c.Groups); err != nil {
+		return err
+	}
+	if err := validateTenants(c.Tenants); err != nil {
+		return err
+	}
+	if err := c.History.validate(); err != nil {
+		return err
+	}
+	if err := c.Cluster.validate(); err != nil {
+		return err
+	}
+	if c.Catalog != "" && c.Trace.Replay != "" {
+		return fmt.Errorf("catalog cannot be loaded while replaying a trace, which has its own catalog")
+	}
+	return nil
+}
+
+func (c Config) metricsUpdateFrequency() time.Duration {
+	return time.Duration(c.MetricsInterval) * time.Millisecond
+}
@@ -0,0 +1,161 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+const (
+	SineCurve     = "sine"     // Level + Amplitude * sin(2π(t - At) / Period)
+	ConstantCurve = "constant" // Level at every tick
+	DiurnalCurve  = "diurnal"  // daily cycle of Period ticks peaking mid-day, scaled by WeekendFactor on days 6 and 7
+	StepCurve     = "step"     // Level until tick At, then To
+	RampCurve     = "ramp"     // Level until tick At, then linearly to To over Duration ticks
+	SpikesCurve   = "spikes"   // Level, plus Amplitude for Duration ticks every Period ticks starting at At
+	SumCurve      = "sum"      // sum of the Components
+	ProductCurve  = "product"  // product of the Components
+)
+
+// CurveConfig describes a load curve, which scales the arrival rate of every query by tick.
+// Ticks are counted from when the curve became active. Fields a curve does not use are ignored.
+type CurveConfig struct {
+	Name          string        `json:"name"`
+	Level         float64       `json:"level,omitempty"`
+	Amplitude     float64       `json:"amplitude,omitempty"`
+	Period        int           `json:"period,omitempty"`
+	At            int           `json:"at,omitempty"`
+	To            float64       `json:"to,omitempty"`
+	Duration      int           `json:"duration,omitempty"`
+	WeekendFactor float64       `json:"weekend_factor,omitempty"`
+	Components    []CurveConfig `json:"components,omitempty"`
+}
+
+// UnmarshalJSON decodes a curve from scratch rather than over an existing one,
+// so a curve loaded from a config file does not inherit parameters of the default curve.
+// A diurnal curve without a weekend_factor keeps its weekend load the same as on weekdays.
+func (c *CurveConfig) UnmarshalJSON(data []byte) error {
+	type plain CurveConfig
+	var decoded struct {
+		plain
+		WeekendFactor *float64 `json:"weekend_factor"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&decoded); err != nil {
+		return err
+	}
+	*c = CurveConfig(decoded.plain)
+	if decoded.WeekendFactor != nil {
+		c.WeekendFactor = *decoded.WeekendFactor
+	} else if c.Name == DiurnalCurve {
+		c.WeekendFactor = 1
+	}
+	return nil
+}
+
+// MarshalJSON always writes the weekend_factor of a diurnal curve, so a factor of 0 is not read back as unset
+func (c CurveConfig) MarshalJSON() ([]byte, error) {
+	type plain CurveConfig
+	if c.Name != DiurnalCurve {
+		return json.Marshal(plain(c))
+	}
+	return json.Marshal(struct {
+		plain
+		WeekendFactor float64 `json:"weekend_factor"`
+	}{plain(c), c.WeekendFactor})
+}
+
+// defaultCurveConfig is the slow sine wave the simulator has always used
+func defaultCurveConfig() CurveConfig {
+	return CurveConfig{
+		Name:      SineCurve,
+		Level:     1.5,
+		Amplitude: 0.5,
+		Period:    20000,
+		At:        500,
+	}
+}
+
+// newCurve builds the scalar function described by the config
+func newCurve(cfg CurveConfig) (func(int) float64, error) {
+	switch cfg.Name {
+	case SineCurve:
+		if cfg.Period <= 0 {
+			return nil, fmt.Errorf("sine curve needs a positive period")
+		}
+		return func(ticks int) float64 {
+			return cfg.Level + cfg.Amplitude*math.Sin(2*math.Pi*float64(ticks-cfg.At)/float64(cfg.Period))
+		}, nil
+	case ConstantCurve:
+		return func(int) float64 { return cfg.Level }, nil
+	case DiurnalCurve:
+		if cfg.Period <= 0 {
+			return nil, fmt.Errorf("diurnal curve needs a positive period")
+		}
+		return func(ticks int) float64 {
+			day := ticks / cfg.Period
+			scalar := cfg.Level - cfg.Amplitude*math.Cos(2*math.Pi*float64(ticks%cfg.Period)/float64(cfg.Period))
+			if day%7 >= 5 {
+				scalar *= cfg.WeekendFactor
+			}
+			return scalar
+		}, nil
+	case StepCurve:
+		return func(ticks int) float64 {
+			if ticks < cfg.At {
+				return cfg.Level
+			}
+			return cfg.To
+		}, nil
+	case RampCurve:
+		if cfg.Duration <= 0 {
+			return nil, fmt.Errorf("ramp curve needs a positive duration")
+		}
+		return func(ticks int) float64 {
+			progress := math.Min(math.Max(float64(ticks-cfg.At)/float64(cfg.Duration), 0), 1)
+			return cfg.Level + (cfg.To-cfg.Level)*progress
+		}, nil
+	case SpikesCurve:
+		if cfg.Period <= 0 || cfg.Duration <= 0 || cfg.Duration > cfg.Period {
+			return nil, fmt.Errorf("spikes curve needs a positive duration no longer than its period")
+		}
+		return func(ticks int) float64 {
+			if ticks >= cfg.At && (ticks-cfg.At)%cfg.Period < cfg.Duration {
+				return cfg.Level + cfg.Amplitude
+			}
+			return cfg.Level
+		}, nil
+	case SumCurve, ProductCurve:
+		if len(cfg.Components) == 0 {
+			return nil, fmt.Errorf("%s curve needs components", cfg.Name)
+		}
+		components := make([]func(int) float64, len(cfg.Components))
+		for i, component := range cfg.Components {
+			curve, err := newCurve(component)
+			if err != nil {
+				return nil, err
+			}
+			components[i] = curve
+		}
+		if cfg.Name == SumCurve {
+			return func(ticks int) float64 {
+				scalar := 0.0
+				for _, curve := range components {
+					scalar += curve(ticks)
+				}
+				return scalar
+			}, nil
+		}
+		return func(ticks int) float64 {
+			scalar := 1.0
+			for _, curve := range components {
+				scalar *= curve(ticks)
+			}
+			return scalar
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown load curve %q", cfg.Name)
+	}
+}
@@ -0,0 +1,86 @@
+package lib
+
+import (
+	"encoding/json"
+	"math"
+)
+
+func (s *TestSuite) TestDefaultCurveMatchesSine() {
+	curve, err := newCurve(defaultCurveConfig())
+	s.NoError(err)
+	for _, ticks := range []int{0, 500, 5500, 10500, 15500, 30000} {
+		expected := math.Sin((float64(ticks)-500)*math.Pi/10000)/2 + 1.5
+		s.InDelta(expected, curve(ticks), 1e-9)
+	}
+}
+
+func (s *TestSuite) TestCurves() {
+	tests := []struct {
+		cfg      CurveConfig
+		ticks    []int
+		expected []float64
+	}{
+		{CurveConfig{Name: ConstantCurve, Level: 2}, []int{0, 1000}, []float64{2, 2}},
+		{CurveConfig{Name: StepCurve, Level: 1, To: 3, At: 10}, []int{9, 10}, []float64{1, 3}},
+		{CurveConfig{Name: RampCurve, Level: 1, To: 3, At: 10, Duration: 10}, []int{5, 15, 25}, []float64{1, 2, 3}},
+		{CurveConfig{Name: SpikesCurve, Level: 1, Amplitude: 4, Period: 10, Duration: 2, At: 5}, []int{4, 5, 6, 7, 15}, []float64{1, 5, 5, 1, 5}},
+		{CurveConfig{Name: DiurnalCurve, Level: 1, Amplitude: 0.5, Period: 100, WeekendFactor: 0.5}, []int{0, 50, 550}, []float64{0.5, 1.5, 0.75}},
+		{CurveConfig{Name: SumCurve, Components: []CurveConfig{
+			{Name: ConstantCurve, Level: 1},
+			{Name: StepCurve, Level: 0, To: 2, At: 10},
+		}}, []int{0, 10}, []float64{1, 3}},
+		{CurveConfig{Name: ProductCurve, Components: []CurveConfig{
+			{Name: ConstantCurve, Level: 2},
+			{Name: StepCurve, Level: 1, To: 0.5, At: 10},
+		}}, []int{0, 10}, []float64{2, 1}},
+	}
+
+	for _, test := range tests {
+		curve, err := newCurve(test.cfg)
+		s.NoError(err, test.cfg.Name)
+		for i, ticks := range test.ticks {
+			s.InDelta(test.expected[i], curve(ticks), 1e-9, test.cfg.Name)
+		}
+	}
+}
+
+func (s *TestSuite) TestInvalidCurves() {
+	for _, cfg := range []CurveConfig{
+		{Name: "square"},
+		{Name: SineCurve},
+		{Name: RampCurve},
+		{Name: SpikesCurve, Period: 5, Duration: 10},
+		{Name: SumCurve},
+		{Name: SumCurve, Components: []CurveConfig{{Name: "square"}}},
+	} {
+		_, err := newCurve(cfg)
+		s.Error(err, cfg.Name)
+	}
+}
+
+func (s *TestSuite) TestCurveConfigReplacesDefault() {
+	cfg := DefaultConfig()
+	s.NoError(json.Unmarshal([]byte(`{"curve": {"name": "step", "level": 1, "to": 2}}`), &cfg))
+	s.Equal(CurveConfig{Name: StepCurve, Level: 1, To: 2}, cfg.Curve)
+}
+
+func (s *TestSuite) TestCurveWeekendFactor() {
+	var cfg CurveConfig
+	s.NoError(json.Unmarshal([]byte(`{"name": "diurnal", "level": 1, "period": 100}`), &cfg))
+	s.Equal(1.0, cfg.WeekendFactor)
+	curve, err := newCurve(cfg)
+	s.NoError(err)
+	s.InDelta(curve(50), curve(550), 1e-9)
+
+	// An explicit factor of 0 survives a round trip rather than being read back as unset
+	s.NoError(json.Unmarshal([]byte(`{"name": "diurnal", "level": 1, "period": 100, "weekend_factor": 0}`), &cfg))
+	s.Zero(cfg.WeekendFactor)
+	data, err := json.Marshal(cfg)
+	s.NoError(err)
+	s.NoError(json.Unmarshal(data, &cfg))
+	s.Zero(cfg.WeekendFactor)
+
+	data, err = json.Marshal(CurveConfig{Name: ConstantCurve, Level: 2})
+	s.NoError(err)
+	s.JSONEq(`{"name": "constant", "level": 2}`, string(data))
+}
@@ -1,23 +1,32 @@
 package lib
 
 import (
+	"sync"
 	"time"
 )
 
 type Daemon struct {
 	queue              *Queue
+	running            *runSet  // running holds the executions in flight, which use resources until they complete, on the primary of a cluster
+	cluster            *cluster // cluster runs the executions on the nodes they are routed to, if configured
 	resourceUpdateChan chan<- ResourceUpdate
 	queueListeners     []chan *QueuedOperation
+	eventListeners     []chan *Event
 	tickrate           int
 	scalarFunc         func(int) float64 // this allows us to have cyclic behavior, so we can simulate traffic over time
+	curve              CurveConfig       // curve describes the active scalarFunc
+	curveStart         int               // curveStart is the tick on which the active scalarFunc was set
+	curveMu            sync.Mutex        // curveMu guards the curve fields and ticks, as the curve may be replaced at runtime
 	ticks              int
 }
 
 func newDaemon(queue *Queue, resourceUpdateChan chan<- ResourceUpdate, tickrate int, scalarFunc func(int) float64) *Daemon {
 	return &Daemon{
 		queue:              queue,
+		running:            newRunSet(),
 		resourceUpdateChan: resourceUpdateChan,
 		queueListeners:     make([]chan *QueuedOperation, 0),
+		eventListeners:     make([]chan *Event, 0),
 		tickrate:           tickrate,
 		scalarFunc:         scalarFunc,
 		ticks:              0,
@@ -31,19 +40,76 @@ func (d *Daemon) run() {
 	for {
 		select {
 		case <-ticker.C:
-			queued, executed := d.queue.tick(d.scalarFunc(d.ticks))
+			// The queue stays locked until the executions run, so the API never sees them half-updated
+			d.queue.mu.Lock()
+			if d.cluster != nil {
+				d.queue.inFlight = d.cluster.usage()
+			} else {
+				d.queue.inFlight = d.running.usage()
+			}
+			queued, executed := d.queue.tick(d.nextScalar())
+			events := d.queue.drainEvents()
 			d.queueEvent(queued)
-			d.resourceUpdateChan <- sumResources(executed)
-			d.ticks++
+
+			var update ResourceUpdate
+			var nodeUpdates []ResourceUpdate
+			if d.cluster != nil {
+				update, nodeUpdates = d.cluster.tick(executed, d.queue.ticks)
+			} else {
+				d.running.start(executed)
+				d.running.now = d.queue.ticks
+				update = d.running.tick()
+			}
+			update.Queue = countEvents(events)
+			update.Depth = len(d.queue.queued)
+			if d.queue.cache != nil {
+				update.Cache = d.queue.cache.drain()
+			}
+			d.queue.mu.Unlock()
+
+			d.publishEvents(events)
+			if d.cluster != nil {
+				d.cluster.publish(nodeUpdates)
+			}
+			d.resourceUpdateChan <- update
 		}
 	}
 }
 
+// nextScalar evaluates the active load curve at the current tick and advances the tick
+func (d *Daemon) nextScalar() float64 {
+	d.curveMu.Lock()
+	defer d.curveMu.Unlock()
+	scalar := d.scalarFunc(d.ticks - d.curveStart)
+	d.ticks++
+	return scalar
+}
+
+func (d *Daemon) getCurve() CurveConfig {
+	d.curveMu.Lock()
+	defer d.curveMu.Unlock()
+	return d.curve
+}
+
+func (d *Daemon) setCurve(cfg CurveConfig, scalarFunc func(int) float64) {
+	d.curveMu.Lock()
+	defer d.curveMu.Unlock()
+	d.curve = cfg
+	d.scalarFunc = scalarFunc
+	d.curveStart = d.ticks
+}
+
 func (d *Daemon) addQueueListener(listener chan *QueuedOperation) {
 	d.queueListeners = append(d.queueListeners, listener)
 }
 
+func (d *Daemon) addEventListener(listener chan *Event) {
+	d.eventListeners = append(d.eventListeners, listener)
+}
+
 func (d *Daemon) getQueued() []*QueuedOperation {
+	d.queue.mu.Lock()
+	defer d.queue.mu.Unlock()
 	queued := d.queue.getQueued()
 	res := make([]*QueuedOperation, 0, len(queued))
 	for _, q := range queued {
@@ -54,12 +120,26 @@ func (d *Daemon) getQueued() []*QueuedOperation {
 			Execution: QueuedExecution{
 				ID:        q.id.String(),
 				Timestamp: time.Now().Add(time.Duration(q.delay) * time.Millisecond).UnixMilli(),
+				Priority:  q.priority,
+				Kind:      q.kind,
+				Tenant:    q.tenant,
+				Group:     newQueuedGroup(q),
+				Write:     q.query.write,
+				Node:      d.nodeName(q),
 			},
 		})
 	}
 	return res
 }
 
+// nodeName returns the name of the cluster node the execution is routed to, or "" without a cluster
+func (d *Daemon) nodeName(execution *Execution) string {
+	if d.cluster == nil {
+		return ""
+	}
+	return d.cluster.nodes[execution.node].name
+}
+
 func (d *Daemon) queueEvent(queueUpdate []*Execution) {
 	for _, execution := range queueUpdate {
 		offset := time.Duration(float64(execution.delay)/float64(d.tickrate)) * time.Second
@@ -72,6 +152,12 @@ func (d *Daemon) queueEvent(queueUpdate []*Execution) {
 			Execution: QueuedExecution{
 				ID:        execution.id.String(),
 				Timestamp: time.Now().Add(offset).UnixMilli(),
+				Priority:  execution.priority,
+				Kind:      execution.kind,
+				Tenant:    execution.tenant,
+				Group:     newQueuedGroup(execution),
+				Write:     execution.query.write,
+				Node:      d.nodeName(execution),
 			},
 		}
 
@@ -87,14 +173,24 @@ func (d *Daemon) queueEvent(queueUpdate []*Execution) {
 	}
 }
 
+func (d *Daemon) publishEvents(events []*Event) {
+	for _, event := range events {
+		for _, listener := range d.eventListeners {
+			// Try to send to channel, but if it's full, remove oldest item first
+			select {
+			case listener <- event:
+			default:
+				<-listener
+				listener <- event
+			}
+		}
+	}
+}
+
 func sumResources(executions []*Execution) ResourceUpdate {
-	cpu := 0
-	memory := 0
-	io := 0
+	usage := make(Resources)
 	for _, execution := range executions {
-		cpu += execution.query.cpuUsage
-		memory += execution.query.memoryUsage
-		io += execution.query.ioUsage
+		usage.add(execution.usage, 1)
 	}
-	return ResourceUpdate{cpu, memory, io}
+	return ResourceUpdate{Usage: usage}
 }
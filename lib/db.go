@@ -1,9 +1,6 @@
 package lib
 
 import (
-	"math"
-	"time"
-
 	"github.com/google/uuid"
 )
 
@@ -14,37 +11,212 @@ type DB struct {
 	resourceUpdateChan <-chan ResourceUpdate
 }
 
-func scalarFunc(ticks int) float64 {
-	scalar := math.Sin((float64(ticks)-500)*math.Pi/10000)/2 + 1.5
-	return scalar
+// NewDB creates a DB using DefaultConfig
+func NewDB() *DB {
+	db, err := NewDBWithConfig(DefaultConfig())
+	if err != nil {
+		panic(err)
+	}
+	return db
 }
 
-func NewDB() *DB {
-	queries := getQueries(100)
-	probs := getExecutionProbs(100)
-	defaultDelay := 1                                        // 1 tick / 100ms default delay
-	metricsUpdateFrequency := time.Second * time.Duration(1) // 1 second metrics update frequency
-	tickrate := 10                                           // 10 ticks per second
+// NewDBWithConfig creates a DB from the given configuration
+func NewDBWithConfig(cfg Config) (*DB, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	scheduler, err := newScheduler(cfg.Scheduler)
+	if err != nil {
+		return nil, err
+	}
+	rng := newRuntimeSource(cfg.Seed)
+	arrivals, err := newArrivalModel(cfg.Arrivals, rng)
+	if err != nil {
+		return nil, err
+	}
+	curve, err := newCurve(cfg.Curve)
+	if err != nil {
+		return nil, err
+	}
+	noise, err := newNoise(cfg.Noise)
+	if err != nil {
+		return nil, err
+	}
+	var churn *churn
+	if cfg.Churn.enabled() {
+		if churn, err = newChurn(cfg.Churn); err != nil {
+			return nil, err
+		}
+		churn.resources = cfg.Resources
+		churn.tenants = cfg.Tenants
+	}
+
+	queries, probs, replay, err := loadQueries(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateQueryTenants(queries, cfg.Tenants); err != nil {
+		return nil, err
+	}
+	if err := cfg.Churn.validateFactors(resourceDimensions(cfg.Resources, queries)); err != nil {
+		return nil, err
+	}
+	var recurring *recurringSchedule
+	if len(cfg.Recurring) > 0 {
+		if recurring, err = newRecurringSchedule(cfg.Recurring, cfg.Tickrate, cfg.DefaultDelay); err != nil {
+			return nil, err
+		}
+		queries = addTemplates(queries, probs, recurring.queries())
+	}
+	var maintenance *maintenance
+	if cfg.Maintenance.enabled() {
+		maintenance = newMaintenance(cfg.Maintenance)
+		queries = addTemplates(queries, probs, maintenance.templates)
+	}
+	var groups *groupArrivals
+	if len(cfg.Groups) > 0 {
+		if groups, err = newGroupArrivals(cfg.Groups, queries); err != nil {
+			return nil, err
+		}
+	}
 
 	// Channels for event comms between components
 	resourceUpdateChan := make(chan ResourceUpdate, 100) // Handles the resource updates from daemon --> monitor
 
 	// Create components
-	queue := newQueue(queries, probs, defaultDelay)
-	daemon := newDaemon(queue, resourceUpdateChan, tickrate, scalarFunc)
-	monitor := newMonitor(metricsUpdateFrequency, tickrate)
+	queue := newQueue(queries, probs, cfg.DefaultDelay)
+	queue.arrivals = arrivals
+	queue.rng = rng
+	queue.replay = replay
+	queue.scheduler = scheduler
+	queue.budget = cfg.Budget
+	queue.maxDelay = cfg.Priorities.MaxDelay
+	queue.deadlines = cfg.Deadlines
+	queue.backpressure = cfg.Backpressure
+	queue.durations = cfg.Durations
+	queue.noise = noise
+	queue.churn = churn
+	queue.recurring = recurring
+	queue.maintenance = maintenance
+	queue.groups = groups
+	queue.tenantDelay = make(map[string]int, len(cfg.Tenants))
+	for _, tenant := range cfg.Tenants {
+		queue.tenantDelay[tenant.Name] = tenant.MaxDelay
+	}
+	if len(cfg.Tenants) > 0 {
+		queue.latency.byTenant = make(map[string]*latencySplit)
+	}
+	if cfg.History.Retention > 0 {
+		queue.history = newHistoryLog(cfg.History.Retention)
+	}
+	if cfg.Cache.Capacity > 0 {
+		queue.cache = newQueryCache(cfg.Cache)
+	}
+	if cfg.ExportCatalog != "" {
+		if err := WriteCatalog(cfg.ExportCatalog, newCatalog(queries, probs)); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Trace.Record != "" {
+		queue.recorder, err = newTraceRecorder(cfg.Trace.Record, cfg.Trace.Format, newCatalog(queries, probs))
+		if err != nil {
+			return nil, err
+		}
+	}
+	// Every node of a cluster runs its executions the same way, with its own monitor
+	newRunning := func() *runSet {
+		running := newRunSet()
+		running.capacity = cfg.Capacity
+		running.semantics = cfg.Semantics
+		running.latency = queue.latency
+		if throttler, ok := scheduler.(Throttler); ok {
+			running.throttler = throttler
+		}
+		running.tenants = len(cfg.Tenants) > 0
+		running.history = queue.history
+		return running
+	}
+	newMonitorForConfig := func() *Monitor {
+		monitor := newMonitor(cfg.metricsUpdateFrequency(), cfg.Tickrate, resourceDimensions(cfg.Resources, queries))
+		monitor.semantics = cfg.Semantics
+		if len(cfg.Tenants) > 0 {
+			monitor.trackTenants(tenantNames(cfg.Tenants))
+		}
+		return monitor
+	}
+
+	daemon := newDaemon(queue, resourceUpdateChan, cfg.Tickrate, curve)
+	daemon.running = newRunning()
+	daemon.curve = cfg.Curve
+	monitor := newMonitorForConfig()
+	if cfg.Cluster.enabled() {
+		daemon.cluster, err = newCluster(cfg.Cluster, func(name string) *node {
+			return &node{name: name, running: newRunning(), monitor: newMonitorForConfig(), updates: make(chan ResourceUpdate, 100)}
+		})
+		if err != nil {
+			return nil, err
+		}
+		daemon.running = daemon.cluster.nodes[0].running
+		queue.cluster = daemon.cluster
+	}
 
 	return &DB{
 		queue:              queue,
 		daemon:             daemon,
 		monitor:            monitor,
 		resourceUpdateChan: resourceUpdateChan,
+	}, nil
+}
+
+// loadQueries takes the query catalog from the replayed trace or the catalog file, if any, or generates it
+func loadQueries(cfg Config) ([]*Query, *[]float64, *traceReplay, error) {
+	if cfg.Catalog != "" {
+		catalog, err := LoadCatalog(cfg.Catalog)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		queries, probs, err := queriesFromCatalog(catalog)
+		return queries, probs, nil, err
+	}
+	if cfg.Trace.Replay == "" {
+		rng := newRandSource(cfg.Seed)
+		queries := drawQueries(rng, cfg.Queries)
+		probs := drawExecutionProbs(rng, cfg.Queries)
+		assignPriorities(queries, cfg.Priorities, rng)
+		assignDurations(queries, cfg.Durations, rng)
+		assignResources(queries, cfg.Resources, rng)
+		assignTenants(queries, cfg.Tenants, rng)
+		if cfg.Cluster.enabled() {
+			assignWrites(queries, cfg.Cluster.Writes, rng)
+		}
+		return queries, probs, nil, nil
+	}
+
+	reader, catalog, err := openTrace(cfg.Trace.Replay)
+	if err != nil {
+		return nil, nil, nil, err
 	}
+	queries, probs, err := queriesFromCatalog(catalog)
+	if err != nil {
+		reader.file.Close()
+		return nil, nil, nil, err
+	}
+	return queries, probs, newTraceReplay(reader), nil
+}
+
+// GetCatalog returns the query templates and their arrival probabilities
+func (d *DB) GetCatalog() []CatalogEntry {
+	return d.queue.getCatalog()
 }
 
 func (d *DB) Run() {
 	// Start components
 	go d.monitor.run(d.resourceUpdateChan)
+	if d.daemon.cluster != nil {
+		for _, node := range d.daemon.cluster.nodes {
+			go node.monitor.run(node.updates)
+		}
+	}
 	go d.daemon.run()
 }
 
@@ -52,14 +224,94 @@ func (d *DB) AddQueueListener(listener chan *QueuedOperation) {
 	d.daemon.addQueueListener(listener)
 }
 
+// AddEventListener registers a channel to receive the events emitted by the queue, such as carried executions
+func (d *DB) AddEventListener(listener chan *Event) {
+	d.daemon.addEventListener(listener)
+}
+
 func (d *DB) GetQueued() []*QueuedOperation {
 	return d.daemon.getQueued()
 }
 
+// Depth returns the number of executions queued
+func (d *DB) Depth() int {
+	d.queue.mu.Lock()
+	defer d.queue.mu.Unlock()
+	return len(d.queue.queued)
+}
+
 func (d *DB) GetResources() *ResourceMetrics {
 	return d.monitor.getResources()
 }
 
+// GetLatency returns the distribution of time from enqueue to execution, per query template and overall
+func (d *DB) GetLatency() *LatencyMetrics {
+	return d.queue.latency.snapshot(d.daemon.tickrate)
+}
+
+// GetCacheStats returns the query result cache lookups since startup, all zero if the cache is disabled
+func (d *DB) GetCacheStats() CacheStats {
+	if d.queue.cache == nil {
+		return CacheStats{}
+	}
+	return d.queue.cache.totals()
+}
+
+// GetLoadCurve returns the load curve currently scaling query arrivals
+func (d *DB) GetLoadCurve() CurveConfig {
+	return d.daemon.getCurve()
+}
+
+// SetLoadCurve replaces the load curve at runtime, with the new curve starting from its tick 0
+func (d *DB) SetLoadCurve(cfg CurveConfig) error {
+	curve, err := newCurve(cfg)
+	if err != nil {
+		return err
+	}
+	d.daemon.setCurve(cfg, curve)
+	return nil
+}
+
 func (d *DB) Delay(id uuid.UUID, delay int) error {
 	return d.queue.delay(id, delay)
 }
+
+// DelayWithSchedule applies Delay and returns the tick the execution is due on before and after it
+func (d *DB) DelayWithSchedule(id uuid.UUID, delay int) (Schedule, error) {
+	return d.queue.delayWithSchedule(id, delay)
+}
+
+// GetNodes returns the resource utilization of every node of the cluster, the primary first, or nil without a cluster
+func (d *DB) GetNodes() []NodeMetrics {
+	if d.daemon.cluster == nil {
+		return nil
+	}
+	nodes := make([]NodeMetrics, len(d.daemon.cluster.nodes))
+	for i, node := range d.daemon.cluster.nodes {
+		nodes[i] = NodeMetrics{Name: node.name, Primary: i == 0, Resources: node.monitor.getResources()}
+	}
+	return nodes
+}
+
+// Route moves a queued execution to the named node of the cluster, overriding the router
+func (d *DB) Route(id uuid.UUID, node string) error {
+	return d.queue.reroute(id, node)
+}
+
+// RouteWithSchedule applies Route and returns the tick the execution is due on before and after it
+func (d *DB) RouteWithSchedule(id uuid.UUID, node string) (Schedule, error) {
+	return d.queue.rerouteWithSchedule(id, node)
+}
+
+// GetExecution returns the lifecycle of a recent execution, ErrExecutionNotFound if its history is no
+// longer kept, or ErrHistoryDisabled if no history is kept at all
+func (d *DB) GetExecution(id uuid.UUID) (ExecutionHistory, error) {
+	if d.queue.history == nil {
+		return ExecutionHistory{}, ErrHistoryDisabled
+	}
+	history, ok := d.queue.history.get(id)
+	if !ok {
+		return ExecutionHistory{}, ErrExecutionNotFound
+	}
+	return history, nil
+}
@@ -0,0 +1,54 @@
+package lib
+
+import (
+	"fmt"
+)
+
+// DeadlinePolicy is what the queue does with an execution that would miss its deadline
+type DeadlinePolicy string
+
+const (
+	DeadlineForceRun DeadlinePolicy = "force_run" // run the execution on the tick it would otherwise be deferred past its deadline
+	DeadlineExpire   DeadlinePolicy = "expire"    // drop the execution without running it
+)
+
+// DeadlineConfig bounds the total time an execution may spend in the queue
+type DeadlineConfig struct {
+	MaxLatency map[Priority]int `json:"max_latency"` // MaxLatency is the most ticks an execution may stay queued per priority, 0 for no deadline
+	Policy     DeadlinePolicy   `json:"policy"`      // Policy is applied to executions that would miss their deadline
+}
+
+// defaultDeadlineConfig sets no deadline for any priority, so deadlines are opt-in
+func defaultDeadlineConfig() DeadlineConfig {
+	return DeadlineConfig{Policy: DeadlineForceRun}
+}
+
+func (c DeadlineConfig) validate() error {
+	if c.Policy != DeadlineForceRun && c.Policy != DeadlineExpire {
+		return fmt.Errorf("unknown deadline policy %q", c.Policy)
+	}
+	for priority, maxLatency := range c.MaxLatency {
+		if maxLatency < 0 {
+			return fmt.Errorf("max_latency for %s must not be negative", priority)
+		}
+	}
+	return nil
+}
+
+// deadlineFor returns the tick by which the execution must run, or 0 if it has no deadline.
+// A template's own max latency takes precedence over the one for its priority.
+func (c DeadlineConfig) deadlineFor(execution *Execution) int {
+	maxLatency := execution.query.maxLatency
+	if maxLatency == 0 {
+		maxLatency = c.MaxLatency[execution.priority]
+	}
+	if maxLatency == 0 {
+		return 0
+	}
+	return execution.queuedAt + maxLatency
+}
+
+// misses reports whether the execution, once its remaining delay elapses, would run after its deadline
+func (e *Execution) misses(tick int) bool {
+	return e.deadline > 0 && tick+e.delay > e.deadline
+}
@@ -0,0 +1,64 @@
+package lib
+
+import (
+	"github.com/google/uuid"
+)
+
+func (s *TestSuite) TestDeadlineFor() {
+	cfg := DeadlineConfig{MaxLatency: map[Priority]int{PriorityHigh: 10}}
+	query := &Query{}
+	s.Equal(15, cfg.deadlineFor(&Execution{query: query, queuedAt: 5, priority: PriorityHigh}))
+	s.Equal(0, cfg.deadlineFor(&Execution{query: query, queuedAt: 5, priority: PriorityLow}))
+
+	query.maxLatency = 3
+	s.Equal(8, cfg.deadlineFor(&Execution{query: query, queuedAt: 5, priority: PriorityLow}))
+
+	// Deadlines are opt-in
+	s.Equal(0, defaultDeadlineConfig().deadlineFor(&Execution{query: &Query{}, queuedAt: 5, priority: PriorityHigh}))
+}
+
+func (s *TestSuite) TestDelayRefusesPastDeadline() {
+	queue := newQueue(getQueries(1), getExecutionProbs(1), 1)
+	execution := &Execution{query: queue.queries[0], id: uuid.New(), delay: 1, deadline: 10}
+	queue.queued[execution.id] = execution
+
+	s.NoError(queue.delay(execution.id, 9))
+	s.ErrorIs(queue.delay(execution.id, 1), ErrDeadlineExceeded)
+	s.Equal(10, execution.delay)
+}
+
+func (s *TestSuite) TestDeadlinePolicies() {
+	for _, policy := range []DeadlinePolicy{DeadlineForceRun, DeadlineExpire} {
+		queries := getQueries(100)
+		for _, query := range queries {
+			query.priority = PriorityLow
+		}
+		queue := newQueue(queries, getExecutionProbs(100), 1)
+		queue.scheduler = holdScheduler{}
+		queue.deadlines = DeadlineConfig{MaxLatency: map[Priority]int{PriorityLow: 5}, Policy: policy}
+
+		stats := QueueStats{}
+		for i := 0; i < 100; i++ {
+			_, executed := queue.tick(1)
+			stats.add(countEvents(queue.drainEvents()))
+			if policy == DeadlineExpire {
+				s.Empty(executed)
+			} else {
+				for _, execution := range executed {
+					s.Equal(queue.ticks, execution.deadline)
+				}
+			}
+			for _, execution := range queue.queued {
+				s.LessOrEqual(queue.ticks+execution.delay, execution.deadline)
+			}
+		}
+
+		if policy == DeadlineExpire {
+			s.Positive(stats.Expired)
+			s.Zero(stats.ForcedRun)
+		} else {
+			s.Positive(stats.ForcedRun)
+			s.Zero(stats.Expired)
+		}
+	}
+}
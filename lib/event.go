@@ -0,0 +1,91 @@
+package lib
+
+import (
+	"time"
+)
+
+// EventType identifies an action the queue took on an execution
+type EventType string
+
+const (
+	EventCarried   EventType = "carried"  // the execution exceeded the tick budget and was carried to the next tick
+	EventExpired   EventType = "expired"  // the execution would have missed its deadline and was dropped
+	EventForcedRun EventType = "forced"   // the execution would have missed its deadline and was run regardless
+	EventDropped   EventType = "dropped"  // the execution arrived while the queue was full and was rejected
+	EventEvicted   EventType = "evicted"  // the execution was dropped from the full queue to make room
+	EventOverflow  EventType = "overflow" // the execution was run early to make room in the full queue
+
+	EventDrifted    EventType = "drifted"    // the query template's usage shifted
+	EventRetired    EventType = "retired"    // the query template stopped arriving
+	EventIntroduced EventType = "introduced" // the query template was added to the catalog
+)
+
+// Event represents an action the queue took on an execution, or a change to a query template, during a tick
+type Event struct {
+	Type      EventType `json:"type"`
+	Tick      int       `json:"tick"`
+	Execution string    `json:"execution,omitempty"`
+	Query     string    `json:"query,omitempty"`
+	Tenant    string    `json:"tenant,omitempty"`
+	Timestamp int64     `json:"timestamp"`
+}
+
+// QueueStats counts the events emitted by the queue over a period
+type QueueStats struct {
+	Carried   int `json:"carried"`
+	Expired   int `json:"expired"`
+	ForcedRun int `json:"forced"`
+	Dropped   int `json:"dropped"`
+	Evicted   int `json:"evicted"`
+	Overflow  int `json:"overflow"`
+}
+
+func newExecutionEvent(eventType EventType, tick int, execution *Execution) *Event {
+	return &Event{
+		Type:      eventType,
+		Tick:      tick,
+		Execution: execution.id.String(),
+		Query:     execution.query.id.String(),
+		Tenant:    execution.tenant,
+		Timestamp: time.Now().UnixMilli(),
+	}
+}
+
+func newQueryEvent(eventType EventType, tick int, query *Query) *Event {
+	return &Event{
+		Type:      eventType,
+		Tick:      tick,
+		Query:     query.id.String(),
+		Timestamp: time.Now().UnixMilli(),
+	}
+}
+
+func (s *QueueStats) add(other QueueStats) {
+	s.Carried += other.Carried
+	s.Expired += other.Expired
+	s.ForcedRun += other.ForcedRun
+	s.Dropped += other.Dropped
+	s.Evicted += other.Evicted
+	s.Overflow += other.Overflow
+}
+
+func countEvents(events []*Event) QueueStats {
+	stats := QueueStats{}
+	for _, event := range events {
+		switch event.Type {
+		case EventCarried:
+			stats.Carried++
+		case EventExpired:
+			stats.Expired++
+		case EventForcedRun:
+			stats.ForcedRun++
+		case EventDropped:
+			stats.Dropped++
+		case EventEvicted:
+			stats.Evicted++
+		case EventOverflow:
+			stats.Overflow++
+		}
+	}
+	return stats
+}
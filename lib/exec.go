@@ -1,22 +1,142 @@
 package lib
 
-import (
-	"math/rand"
-
-	"github.com/google/uuid"
-)
+import "github.com/google/uuid"
 
 type Execution struct {
-	query *Query
-	id    uuid.UUID // id is the unique identifier for the execution
-	delay int       // delay is the number of ticks before the query is executed
+	query      *Query
+	id         uuid.UUID // id is the unique identifier for the execution
+	delay      int       // delay is the number of ticks before the query is executed
+	queuedAt   int       // queuedAt is the queue tick on which the execution arrived
+	priority   Priority  // priority is the priority of the query at the time it was queued
+	addedDelay int       // addedDelay is the number of ticks added to the execution through the delay API
+	deadline   int       // deadline is the last queue tick on which the execution may run, 0 for none
+	duration   int       // duration is the number of ticks the execution runs for once started
+	usage      Resources // usage is the usage of the execution, which varies around its query's when noise is configured
+	kind       ExecutionKind
+	finishBy   int    // finishBy is the queue tick by which a maintenance task must complete, 0 for none
+	group      *group // group is the chain or transaction the execution belongs to, if any
+	position   int    // position is the index of the execution in its group
+	completed  bool   // completed is set once the execution has finished running
+	expired    bool   // expired is set once the execution has been dropped for missing its deadline
+	tenant     string // tenant is the customer the execution belongs to
+	node       int    // node is the index of the cluster node the execution runs on, 0 for the primary
+}
+
+func newExecution(query *Query, id uuid.UUID, delay int) *Execution {
+	return &Execution{
+		query:    query,
+		id:       id,
+		delay:    delay,
+		priority: query.priority,
+		duration: query.duration,
+		usage:    query.usage.clone(),
+		kind:     KindQuery,
+		tenant:   query.tenant,
+	}
+}
+
+// ID returns the unique identifier of the execution
+func (e *Execution) ID() uuid.UUID {
+	return e.id
+}
+
+// QueryID returns the identifier of the query template being executed
+func (e *Execution) QueryID() uuid.UUID {
+	return e.query.id
+}
+
+// Delay returns the number of ticks remaining before the execution is due
+func (e *Execution) Delay() int {
+	return e.delay
+}
+
+// Priority returns the priority of the execution
+func (e *Execution) Priority() Priority {
+	return e.priority
+}
+
+// Deadline returns the last queue tick on which the execution may run, or 0 if it has no deadline
+func (e *Execution) Deadline() int {
+	return e.deadline
+}
+
+// Duration returns the number of ticks the execution runs for once started
+func (e *Execution) Duration() int {
+	return e.duration
+}
+
+// Kind returns whether the execution is a query or a maintenance task
+func (e *Execution) Kind() ExecutionKind {
+	return e.kind
+}
+
+// FinishBy returns the queue tick by which a maintenance task must complete, or 0 for a query
+func (e *Execution) FinishBy() int {
+	return e.finishBy
+}
+
+// Tenant returns the customer the execution belongs to
+func (e *Execution) Tenant() string {
+	return e.tenant
+}
+
+// Profile returns the resource the execution's query is bound by
+func (e *Execution) Profile() Profile {
+	return e.query.profile
+}
+
+// Usage returns the usage of the execution on each tick of work, by resource
+func (e *Execution) Usage() Resources {
+	return e.usage.clone()
+}
+
+// Write returns whether the execution writes, in which case it runs on the primary of a cluster
+func (e *Execution) Write() bool {
+	return e.query.write
+}
+
+// Node returns the index of the cluster node the execution runs on, 0 for the primary
+func (e *Execution) Node() int {
+	return e.node
+}
+
+// GroupID returns the ID of the chain or transaction the execution belongs to, or uuid.Nil if none
+func (e *Execution) GroupID() uuid.UUID {
+	if e.group == nil {
+		return uuid.Nil
+	}
+	return e.group.id
+}
+
+// GroupType returns the type of the execution's group, or "" if it has none
+func (e *Execution) GroupType() GroupType {
+	if e.group == nil {
+		return ""
+	}
+	return e.group.kind
+}
+
+// Position returns the index of the execution in its group, its order in a chain
+func (e *Execution) Position() int {
+	return e.position
+}
+
+// SetDelay sets the number of ticks before the execution is reconsidered, for use by schedulers
+// deferring an execution further than the next tick
+func (e *Execution) SetDelay(delay int) {
+	e.delay = delay
 }
 
 // getExecutionProbs returns the probability of execution at a given tick for each query
 func getExecutionProbs(n int) *[]float64 {
+	return drawExecutionProbs(processRand{}, n)
+}
+
+// drawExecutionProbs draws the probability of execution of n queries from the source
+func drawExecutionProbs(rng randSource, n int) *[]float64 {
 	probs := make([]float64, n)
 	for i := 0; i < n; i++ {
-		probs[i] = rand.ExpFloat64() / float64(n)
+		probs[i] = rng.ExpFloat64() / float64(n)
 	}
 	return &probs
 }
@@ -24,25 +144,22 @@ func getExecutionProbs(n int) *[]float64 {
 // selectExecutedIdx returns the indices of the queries that are executed at a given tick
 // scalar is the scalar by which the probabilities are multiplied, to provide the opportunity
 // to control the number of queries executed at a given tick
-func selectExecutedIdx(probs *[]float64, scalar float64) []int {
+func selectExecutedIdx(rng randSource, probs *[]float64, scalar float64) []int {
 	executed := make([]int, 0)
 	for i := 0; i < len(*probs); i++ {
-		if rand.Float64() < (*probs)[i]*scalar {
+		if rng.Float64() < (*probs)[i]*scalar {
 			executed = append(executed, i)
 		}
 	}
 	return executed
 }
 
-func selectExecutedQueries(probs *[]float64, queries []*Query, scalar float64, delay int) []*Execution {
-	executed := selectExecutedIdx(probs, scalar)
+// selectExecutedQueries creates an execution for each query the arrival model selects at a given tick
+func selectExecutedQueries(rng randSource, model ArrivalModel, probs *[]float64, queries []*Query, scalar float64, delay int) []*Execution {
+	executed := model.Arrivals(probs, scalar)
 	executedQueries := make([]*Execution, len(executed))
 	for i, idx := range executed {
-		executedQueries[i] = &Execution{
-			query: queries[idx],
-			id:    uuid.New(),
-			delay: delay,
-		}
+		executedQueries[i] = newExecution(queries[idx], newRandomID(rng), delay)
 	}
 	return executedQueries
 }
@@ -12,6 +12,6 @@ func (s *TestSuite) TestGetExecutionProbs() {
 
 func (s *TestSuite) TestSelectExecutedIdx() {
 	probs := getExecutionProbs(100)
-	executed := selectExecutedIdx(probs, 1)
+	executed := selectExecutedIdx(processRand{}, probs, 1)
 	s.InDelta(len(executed), 1, 2)
 }
@@ -0,0 +1,208 @@
+package lib
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// GroupType is how the executions of a group depend on each other
+type GroupType string
+
+const (
+	GroupChain       GroupType = "chain"       // each member runs only after the one before it completes
+	GroupTransaction GroupType = "transaction" // every member runs on the same tick, or none does
+)
+
+// GroupConfig is a group of query templates that arrive together
+type GroupConfig struct {
+	Name    string    `json:"name"`
+	Type    GroupType `json:"type"`
+	Queries []string  `json:"queries"` // Queries are the names or IDs of the member templates, in order
+	Rate    float64   `json:"rate"`    // Rate is the chance per tick of the group arriving
+}
+
+func validateGroups(groups []GroupConfig) error {
+	seen := make(map[string]bool, len(groups))
+	for _, group := range groups {
+		if group.Name == "" || seen[group.Name] {
+			return fmt.Errorf("groups need a unique name")
+		}
+		seen[group.Name] = true
+		if group.Type != GroupChain && group.Type != GroupTransaction {
+			return fmt.Errorf("group %s has unknown type %q", group.Name, group.Type)
+		}
+		if len(group.Queries) < 2 {
+			return fmt.Errorf("group %s needs at least 2 queries", group.Name)
+		}
+		if group.Rate <= 0 || group.Rate > 1 {
+			return fmt.Errorf("group %s rate must be above 0 and at most 1", group.Name)
+		}
+	}
+	return nil
+}
+
+// group is an arrived instance of a group, holding its member executions in order
+type group struct {
+	id      uuid.UUID
+	name    string
+	kind    GroupType
+	members []*Execution
+}
+
+// ready reports whether the member may be considered by the scheduler once its delay elapses.
+// A chain member waits for the one before it to complete, and a transaction waits for every member to be due.
+func (g *group) ready(member *Execution) bool {
+	if g.kind == GroupChain {
+		return member.position == 0 || g.members[member.position-1].completed
+	}
+	for _, other := range g.members {
+		if other.delay > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// dependents returns the members affected by a change to the given one: those after it in a
+// chain, or every other member of a transaction
+func (g *group) dependents(member *Execution) []*Execution {
+	if g.kind == GroupChain {
+		return g.members[member.position+1:]
+	}
+	dependents := make([]*Execution, 0, len(g.members)-1)
+	for _, other := range g.members {
+		if other != member {
+			dependents = append(dependents, other)
+		}
+	}
+	return dependents
+}
+
+// groupArrivals creates the groups that arrive on each tick
+type groupArrivals struct {
+	cfg     []GroupConfig
+	members [][]*Query
+}
+
+// newGroupArrivals resolves the member templates of each group from the catalog
+func newGroupArrivals(cfg []GroupConfig, queries []*Query) (*groupArrivals, error) {
+	g := &groupArrivals{cfg: cfg}
+	for _, group := range cfg {
+		members := make([]*Query, len(group.Queries))
+		for i, ref := range group.Queries {
+			if members[i] = findQuery(queries, ref); members[i] == nil {
+				return nil, fmt.Errorf("group %s references unknown query %q", group.Name, ref)
+			}
+		}
+		g.members = append(g.members, members)
+	}
+	return g, nil
+}
+
+// arrivals returns the member executions of every group arriving this tick
+func (g *groupArrivals) arrivals(rng randSource, delay int) []*Execution {
+	executions := make([]*Execution, 0)
+	for i, cfg := range g.cfg {
+		if rng.Float64() >= cfg.Rate {
+			continue
+		}
+		arrived := &group{id: newRandomID(rng), name: cfg.Name, kind: cfg.Type}
+		for position, query := range g.members[i] {
+			execution := newExecution(query, newRandomID(rng), delay)
+			execution.group = arrived
+			execution.position = position
+			arrived.members = append(arrived.members, execution)
+		}
+		executions = append(executions, arrived.members...)
+	}
+	return executions
+}
+
+// keepTogether makes every transaction run in full or not at all. A transaction with a member
+// that must run runs in full, otherwise a deferred member defers the others.
+func keepTogether(run []*Execution, deferred []*Execution, mustRun func(*Execution) bool) ([]*Execution, []*Execution) {
+	split := make(map[*group]bool)
+	for _, execution := range deferred {
+		if execution.group != nil && execution.group.kind == GroupTransaction {
+			split[execution.group] = true
+		}
+	}
+	if len(split) == 0 {
+		return run, deferred
+	}
+
+	runs := make(map[*group]bool, len(split))
+	for g := range split {
+		for _, member := range g.members {
+			if mustRun(member) {
+				runs[g] = true
+			}
+		}
+	}
+	place := func(execution *Execution, deferred bool) bool {
+		if g := execution.group; g != nil && split[g] {
+			return !runs[g]
+		}
+		return deferred
+	}
+	keptRun := make([]*Execution, 0, len(run))
+	keptDeferred := make([]*Execution, 0, len(deferred))
+	for _, execution := range run {
+		if place(execution, false) {
+			keptDeferred = append(keptDeferred, execution)
+		} else {
+			keptRun = append(keptRun, execution)
+		}
+	}
+	for _, execution := range deferred {
+		if place(execution, true) {
+			keptDeferred = append(keptDeferred, execution)
+		} else {
+			keptRun = append(keptRun, execution)
+		}
+	}
+	return keptRun, keptDeferred
+}
+
+// groupMisses reports whether the execution would miss its deadline if deferred. A transaction
+// member misses when any member does, so the whole transaction is expired or run together.
+func (e *Execution) groupMisses(tick int) bool {
+	if e.group == nil || e.group.kind != GroupTransaction {
+		return e.misses(tick)
+	}
+	for _, member := range e.group.members {
+		if member.misses(tick) {
+			return true
+		}
+	}
+	return false
+}
+
+// QueuedGroup describes the group of a queued execution
+type QueuedGroup struct {
+	ID       string    `json:"id"`
+	Name     string    `json:"name"`
+	Type     GroupType `json:"type"`
+	Position int       `json:"position"`        // Position is the index of the execution in the group, its order in a chain
+	Size     int       `json:"size"`            // Size is the number of executions in the group
+	After    string    `json:"after,omitempty"` // After is the execution that must complete first, for chain members after the first
+}
+
+func newQueuedGroup(execution *Execution) *QueuedGroup {
+	g := execution.group
+	if g == nil {
+		return nil
+	}
+	queued := &QueuedGroup{
+		ID:       g.id.String(),
+		Name:     g.name,
+		Type:     g.kind,
+		Position: execution.position,
+		Size:     len(g.members),
+	}
+	if g.kind == GroupChain && execution.position > 0 {
+		queued.After = g.members[execution.position-1].id.String()
+	}
+	return queued
+}
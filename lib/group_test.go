@@ -0,0 +1,142 @@
+package lib
+
+// deferFirstScheduler defers the first due execution in the queue's order and runs the rest
+type deferFirstScheduler struct{}
+
+func (deferFirstScheduler) Schedule(arrived []*Execution, due []*Execution) ([]*Execution, []*Execution) {
+	if len(due) == 0 {
+		return nil, nil
+	}
+	return due[1:], due[:1]
+}
+
+// groupQueue returns a queue with no random arrivals whose first tick queues one group of the given type
+func groupQueue(kind GroupType) (*Queue, []*Execution) {
+	queries := getQueries(3)
+	for _, query := range queries {
+		query.priority = PriorityLow
+	}
+	probs := []float64{0, 0, 0}
+	queue := newQueue(queries, &probs, 1)
+	groups, _ := newGroupArrivals([]GroupConfig{
+		{Name: "etl", Type: kind, Queries: []string{queries[0].name, queries[1].name, queries[2].id.String()}, Rate: 1},
+	}, queries)
+	queue.groups = groups
+	arrived, _ := queue.tick(1)
+	queue.groups = nil
+	return queue, arrived
+}
+
+func (s *TestSuite) TestChainRunsInOrder() {
+	queue, members := groupQueue(GroupChain)
+	s.Require().Len(members, 3)
+
+	_, executed := queue.tick(1)
+	s.Equal([]*Execution{members[0]}, executed)
+	// The first member has not completed, so the second keeps waiting
+	_, executed = queue.tick(1)
+	s.Empty(executed)
+
+	members[0].completed = true
+	_, executed = queue.tick(1)
+	s.Equal([]*Execution{members[1]}, executed)
+	members[1].completed = true
+	_, executed = queue.tick(1)
+	s.Equal([]*Execution{members[2]}, executed)
+}
+
+func (s *TestSuite) TestDelayPropagatesToDependents() {
+	queue, members := groupQueue(GroupChain)
+	s.NoError(queue.delay(members[1].id, 2))
+	s.Equal(1, members[0].delay)
+	s.Equal(3, members[1].delay)
+	s.Equal(3, members[2].delay)
+
+	// A dependent that cannot take the delay blocks it for the whole chain
+	members[2].deadline = queue.ticks + 4
+	s.ErrorIs(queue.delay(members[0].id, 2), ErrDeadlineExceeded)
+	s.Equal(1, members[0].delay)
+	s.Equal(3, members[1].delay)
+}
+
+func (s *TestSuite) TestTransactionRunsTogether() {
+	queue, members := groupQueue(GroupTransaction)
+	queue.scheduler = deferFirstScheduler{}
+	_, executed := queue.tick(1)
+	s.Empty(executed)
+	s.Len(queue.queued, 3)
+
+	// Delaying one member delays the whole transaction
+	s.NoError(queue.delay(members[2].id, 1))
+	queue.scheduler = fifoScheduler{}
+	_, executed = queue.tick(1)
+	s.Empty(executed)
+	_, executed = queue.tick(1)
+	s.ElementsMatch(members, executed)
+}
+
+func (s *TestSuite) TestExpiredChainMemberExpiresDependents() {
+	queue, members := groupQueue(GroupChain)
+	queue.scheduler = holdScheduler{}
+	queue.deadlines = DeadlineConfig{Policy: DeadlineExpire}
+	members[0].deadline = 2
+
+	_, executed := queue.tick(1)
+	s.Empty(executed)
+	events := queue.drainEvents()
+	s.Len(events, 3)
+	for _, event := range events {
+		s.Equal(EventExpired, event.Type)
+	}
+	s.Empty(queue.queued)
+}
+
+func (s *TestSuite) TestQueuedGroup() {
+	_, members := groupQueue(GroupChain)
+	s.Nil(newQueuedGroup(&Execution{}))
+	group := newQueuedGroup(members[1])
+	s.Equal(members[0].GroupID().String(), group.ID)
+	s.Equal(GroupChain, group.Type)
+	s.Equal("etl", group.Name)
+	s.Equal(1, group.Position)
+	s.Equal(3, group.Size)
+	s.Equal(members[0].id.String(), group.After)
+	s.Empty(newQueuedGroup(members[0]).After)
+
+	s.Error(validateGroups([]GroupConfig{{Name: "one", Type: GroupChain, Queries: []string{"a"}, Rate: 1}}))
+	s.Error(validateGroups([]GroupConfig{{Name: "type", Type: "batch", Queries: []string{"a", "b"}, Rate: 1}}))
+	s.Error(validateGroups([]GroupConfig{{Name: "rate", Type: GroupChain, Queries: []string{"a", "b"}}}))
+	_, err := newGroupArrivals([]GroupConfig{{Name: "unknown", Type: GroupChain, Queries: []string{"a", "b"}, Rate: 1}}, getQueries(1))
+	s.Error(err)
+}
+
+func (s *TestSuite) TestBlockedChainMemberMissesDeadline() {
+	for _, policy := range []DeadlinePolicy{DeadlineForceRun, DeadlineExpire} {
+		queue, members := groupQueue(GroupChain)
+		queue.deadlines = DeadlineConfig{Policy: policy}
+		members[1].deadline = 4
+
+		// The first member runs but never completes, so the second waits on it until its deadline
+		_, executed := queue.tick(1)
+		s.Equal([]*Execution{members[0]}, executed)
+		_, executed = queue.tick(1)
+		s.Empty(executed)
+		s.Empty(queue.drainEvents())
+
+		_, executed = queue.tick(1)
+		events := queue.drainEvents()
+		if policy == DeadlineExpire {
+			s.Empty(executed)
+			s.Len(events, 2)
+			for _, event := range events {
+				s.Equal(EventExpired, event.Type)
+			}
+			s.Empty(queue.queued)
+		} else {
+			s.Equal([]*Execution{members[1]}, executed)
+			s.Len(events, 1)
+			s.Equal(EventForcedRun, events[0].Type)
+			s.Contains(queue.queued, members[2].id)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package lib
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// latencyBuckets are the upper bounds, in ticks, of the exported latency histogram buckets
+var latencyBuckets = []int{0, 1, 2, 5, 10, 20, 50, 100, 200, 500, 1000}
+
+// LatencyStats summarizes a latency distribution in milliseconds
+type LatencyStats struct {
+	Count   int             `json:"count"`
+	Mean    float64         `json:"mean"`
+	P50     int             `json:"p50"`
+	P90     int             `json:"p90"`
+	P95     int             `json:"p95"`
+	P99     int             `json:"p99"`
+	Max     int             `json:"max"`
+	Sum     int             `json:"-"` // Sum is the total of all observations
+	Buckets []LatencyBucket `json:"-"` // Buckets holds the cumulative histogram, for Prometheus exposition
+}
+
+// LatencyBucket is a cumulative histogram bucket
+type LatencyBucket struct {
+	UpperBound int // UpperBound is the inclusive upper bound of the bucket in milliseconds
+	Count      int // Count is the number of observations at or below the upper bound
+}
+
+// LatencyReport is the enqueue-to-execution latency of a query template, a tenant or all queries,
+// split into the default delay and the delay added on top of it. Stretch is how much longer than
+// their duration executions ran once started, because the capacity was saturated.
+type LatencyReport struct {
+	Query   string       `json:"query,omitempty"`
+	Tenant  string       `json:"tenant,omitempty"`
+	Total   LatencyStats `json:"total"`
+	Default LatencyStats `json:"default"`
+	Added   LatencyStats `json:"added"`
+	Stretch LatencyStats `json:"stretch"`
+}
+
+// LatencyMetrics holds the latency reports for all queries executed since startup
+type LatencyMetrics struct {
+	Overall   LatencyReport   `json:"overall"`
+	Queries   []LatencyReport `json:"queries"`
+	Tenants   []LatencyReport `json:"tenants,omitempty"` // Tenants holds a report per tenant, if tenants are configured
+	Timestamp int64           `json:"timestamp"`
+}
+
+// latencyHistogram counts observations per tick value, so percentiles are exact
+type latencyHistogram struct {
+	counts map[int]int
+}
+
+type latencySplit struct {
+	total    latencyHistogram
+	defaults latencyHistogram
+	added    latencyHistogram
+	stretch  latencyHistogram
+}
+
+// latencyRecorder records the queue latency of executed queries per template, per tenant and overall
+type latencyRecorder struct {
+	mu       sync.Mutex
+	overall  *latencySplit
+	byQuery  map[uuid.UUID]*latencySplit
+	byTenant map[string]*latencySplit // byTenant is nil unless tenants are configured
+}
+
+func newLatencyRecorder() *latencyRecorder {
+	return &latencyRecorder{
+		overall: newLatencySplit(),
+		byQuery: make(map[uuid.UUID]*latencySplit),
+	}
+}
+
+func newLatencySplit() *latencySplit {
+	return &latencySplit{
+		total:    latencyHistogram{counts: make(map[int]int)},
+		defaults: latencyHistogram{counts: make(map[int]int)},
+		added:    latencyHistogram{counts: make(map[int]int)},
+		stretch:  latencyHistogram{counts: make(map[int]int)},
+	}
+}
+
+// record observes the latency of executions run on the given tick
+func (r *latencyRecorder) record(executions []*Execution, tick int, defaultDelay int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, execution := range executions {
+		total := tick - execution.queuedAt
+		defaults := min(total, defaultDelay)
+		added := total - defaults
+
+		for _, s := range r.splits(execution) {
+			s.total.counts[total]++
+			s.defaults.counts[defaults]++
+			s.added.counts[added]++
+		}
+	}
+}
+
+// recordStretch observes the ticks a completed execution ran beyond its duration
+func (r *latencyRecorder) recordStretch(execution *Execution, stretch int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, s := range r.splits(execution) {
+		s.stretch.counts[stretch]++
+	}
+}
+
+// splits returns every latency the execution counts towards: overall, its query template's and
+// its tenant's if tracked. The caller must hold mu.
+func (r *latencyRecorder) splits(execution *Execution) []*latencySplit {
+	splits := []*latencySplit{r.overall, r.split(execution)}
+	if r.byTenant != nil {
+		split, ok := r.byTenant[execution.tenant]
+		if !ok {
+			split = newLatencySplit()
+			r.byTenant[execution.tenant] = split
+		}
+		splits = append(splits, split)
+	}
+	return splits
+}
+
+// split returns the latencies of the execution's query template, which the caller must hold mu for
+func (r *latencyRecorder) split(execution *Execution) *latencySplit {
+	split, ok := r.byQuery[execution.query.id]
+	if !ok {
+		split = newLatencySplit()
+		r.byQuery[execution.query.id] = split
+	}
+	return split
+}
+
+// snapshot converts the recorded latencies to milliseconds using the tickrate
+func (r *latencyRecorder) snapshot(tickrate int) *LatencyMetrics {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	metrics := &LatencyMetrics{
+		Overall:   r.overall.report("", tickrate),
+		Queries:   make([]LatencyReport, 0, len(r.byQuery)),
+		Timestamp: time.Now().UnixMilli(),
+	}
+	for id, split := range r.byQuery {
+		metrics.Queries = append(metrics.Queries, split.report(id.String(), tickrate))
+	}
+	sort.Slice(metrics.Queries, func(i, j int) bool {
+		return metrics.Queries[i].Query < metrics.Queries[j].Query
+	})
+	for tenant, split := range r.byTenant {
+		report := split.report("", tickrate)
+		report.Tenant = tenant
+		metrics.Tenants = append(metrics.Tenants, report)
+	}
+	sort.Slice(metrics.Tenants, func(i, j int) bool {
+		return metrics.Tenants[i].Tenant < metrics.Tenants[j].Tenant
+	})
+	return metrics
+}
+
+func (s *latencySplit) report(query string, tickrate int) LatencyReport {
+	return LatencyReport{
+		Query:   query,
+		Total:   s.total.stats(tickrate),
+		Default: s.defaults.stats(tickrate),
+		Added:   s.added.stats(tickrate),
+		Stretch: s.stretch.stats(tickrate),
+	}
+}
+
+// ticksToMs converts a number of ticks to milliseconds, multiplying first so that tickrates
+// that do not divide 1000 are not rounded to a whole number of milliseconds per tick
+func ticksToMs(ticks int, tickrate int) int {
+	return ticks * 1000 / tickrate
+}
+
+func (h latencyHistogram) stats(tickrate int) LatencyStats {
+	values := make([]int, 0, len(h.counts))
+	for value := range h.counts {
+		values = append(values, value)
+	}
+	sort.Ints(values)
+
+	stats := LatencyStats{Buckets: make([]LatencyBucket, len(latencyBuckets))}
+	sum := 0
+	for _, value := range values {
+		stats.Count += h.counts[value]
+		sum += value * h.counts[value]
+	}
+	stats.Sum = ticksToMs(sum, tickrate)
+	for i, bound := range latencyBuckets {
+		stats.Buckets[i].UpperBound = ticksToMs(bound, tickrate)
+	}
+	if stats.Count == 0 {
+		return stats
+	}
+
+	stats.Mean = float64(sum) * 1000 / float64(tickrate) / float64(stats.Count)
+	stats.Max = ticksToMs(values[len(values)-1], tickrate)
+	percentiles := []struct {
+		p     float64
+		value *int
+	}{{0.5, &stats.P50}, {0.9, &stats.P90}, {0.95, &stats.P95}, {0.99, &stats.P99}}
+
+	seen := 0
+	next := 0
+	for _, value := range values {
+		seen += h.counts[value]
+		for next < len(percentiles) && float64(seen) >= percentiles[next].p*float64(stats.Count) {
+			*percentiles[next].value = ticksToMs(value, tickrate)
+			next++
+		}
+		for i, bound := range latencyBuckets {
+			if value <= bound {
+				stats.Buckets[i].Count += h.counts[value]
+			}
+		}
+	}
+	return stats
+}
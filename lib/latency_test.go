@@ -0,0 +1,65 @@
+package lib
+
+func (s *TestSuite) TestLatencyRecorder() {
+	recorder := newLatencyRecorder()
+	query := getQuery(CPU)
+	other := getQuery(IO)
+
+	executions := make([]*Execution, 0)
+	for i := 0; i < 100; i++ {
+		executions = append(executions, &Execution{query: query, queuedAt: 100 - i})
+	}
+	executions = append(executions, &Execution{query: other, queuedAt: 99})
+	recorder.record(executions, 101, 1)
+
+	metrics := recorder.snapshot(10)
+	s.Len(metrics.Queries, 2)
+
+	overall := metrics.Overall
+	s.Equal(101, overall.Total.Count)
+	s.Equal(10000, overall.Total.Max)
+	s.Equal(5000, overall.Total.P50)
+	s.Equal(9900, overall.Total.P99)
+	s.Equal(100, overall.Default.Max)
+	s.Equal(9900, overall.Added.Max)
+	s.Equal(overall.Total.Sum, overall.Default.Sum+overall.Added.Sum)
+
+	for _, report := range metrics.Queries {
+		if report.Query == other.id.String() {
+			s.Equal(1, report.Total.Count)
+			s.Equal(200, report.Total.Max)
+			s.Equal(100, report.Added.P50)
+		}
+	}
+
+	buckets := overall.Total.Buckets
+	s.Equal(0, buckets[0].Count)
+	s.Equal(100, buckets[1].UpperBound)
+	s.Equal(1, buckets[1].Count)
+	s.Equal(101, buckets[len(buckets)-1].Count)
+}
+
+func (s *TestSuite) TestLatencyUnevenTickrate() {
+	recorder := newLatencyRecorder()
+	recorder.record([]*Execution{{query: getQuery(CPU), queuedAt: 1}}, 101, 0)
+
+	// 3 ticks a second is 333.33ms a tick, which must not round down before scaling
+	total := recorder.snapshot(3).Overall.Total
+	s.Equal(33333, total.Max)
+	s.Equal(33333, total.Sum)
+	s.InDelta(33333.3, total.Mean, 0.1)
+}
+
+func (s *TestSuite) TestQueueRecordsLatency() {
+	queue := newQueue(getQueries(100), getExecutionProbs(100), 1)
+	executed := 0
+	for i := 0; i < 100; i++ {
+		_, run := queue.tick(1)
+		executed += len(run)
+	}
+
+	metrics := queue.latency.snapshot(10)
+	s.Equal(executed, metrics.Overall.Total.Count)
+	s.Equal(100, metrics.Overall.Total.Max)
+	s.Equal(0, metrics.Overall.Added.Max)
+}
@@ -0,0 +1,148 @@
+package lib
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ExecutionState is a stage of the lifecycle of an execution
+type ExecutionState string
+
+const (
+	StateQueued    ExecutionState = "queued"    // the execution arrived and waits for its default delay
+	StateDelayed   ExecutionState = "delayed"   // the execution was held back past the tick it was due on
+	StateDue       ExecutionState = "due"       // the execution's delay elapsed and the scheduler considers it
+	StateRunning   ExecutionState = "running"   // the execution started running
+	StateCompleted ExecutionState = "completed" // the execution finished running
+	StateCancelled ExecutionState = "cancelled" // the execution was dropped because a member of its group was
+	StateExpired   ExecutionState = "expired"   // the execution was dropped for missing its deadline
+	StateDropped   ExecutionState = "dropped"   // the execution was dropped by backpressure
+)
+
+// Actor is what caused a transition of an execution
+type Actor string
+
+const (
+	ActorDefault   Actor = "default"   // the queue's own flow, including the scheduler running a due execution
+	ActorScheduler Actor = "scheduler" // the scheduler deferring a due execution
+	ActorDelayAPI  Actor = "delay_api" // a call to the delay API
+	ActorPolicy    Actor = "policy"    // a policy the scheduler may not override: the budget, deadlines, quotas, groups or backpressure
+)
+
+// HistoryConfig controls the history of transitions kept per execution
+type HistoryConfig struct {
+	Retention int `json:"retention"` // Retention is the number of executions whose history is kept, the oldest forgotten first, 0 to disable
+}
+
+func defaultHistoryConfig() HistoryConfig {
+	return HistoryConfig{Retention: 10000}
+}
+
+func (c HistoryConfig) validate() error {
+	if c.Retention < 0 {
+		return fmt.Errorf("history retention must not be negative")
+	}
+	return nil
+}
+
+// historyTransitions is the most transitions kept per execution. Once an execution has that many,
+// the first half is kept and each new transition replaces the oldest of the rest, so an execution
+// deferred for a long time keeps how it arrived and what happened to it lately.
+const historyTransitions = 32
+
+// Transition is a change of state of an execution
+type Transition struct {
+	State     ExecutionState `json:"state"`
+	Actor     Actor          `json:"actor"`
+	Reason    string         `json:"reason,omitempty"` // Reason is the policy or action behind the transition, if any
+	Tick      int            `json:"tick"`
+	Timestamp int64          `json:"timestamp"`
+}
+
+// ExecutionHistory is the lifecycle of an execution, from its arrival to its last state
+type ExecutionHistory struct {
+	ID          string         `json:"id"`
+	Query       string         `json:"query"`
+	Priority    Priority       `json:"priority"`
+	Tenant      string         `json:"tenant"`
+	State       ExecutionState `json:"state"`
+	Transitions []Transition   `json:"transitions"`
+	Elided      int            `json:"elided,omitempty"` // Elided is the number of transitions dropped between the first and the latest ones kept
+}
+
+// historyLog keeps the history of the most recent executions, forgetting the oldest beyond its
+// retention. It is written by the daemon and read by the API.
+type historyLog struct {
+	mu        sync.Mutex
+	retention int
+	entries   map[uuid.UUID]*ExecutionHistory
+	order     []uuid.UUID // order is a ring of the executions kept, in the order they were first recorded
+	next      int         // next is the position in order of the oldest execution once the ring is full
+}
+
+func newHistoryLog(retention int) *historyLog {
+	return &historyLog{
+		retention: retention,
+		entries:   make(map[uuid.UUID]*ExecutionHistory, retention),
+		order:     make([]uuid.UUID, 0, retention),
+	}
+}
+
+// record appends a transition to the history of the execution
+func (h *historyLog) record(execution *Execution, state ExecutionState, actor Actor, reason string, tick int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	entry, ok := h.entries[execution.id]
+	if !ok {
+		entry = &ExecutionHistory{
+			ID:       execution.id.String(),
+			Query:    execution.query.id.String(),
+			Priority: execution.priority,
+			Tenant:   execution.tenant,
+		}
+		if len(h.order) < h.retention {
+			h.order = append(h.order, execution.id)
+		} else {
+			delete(h.entries, h.order[h.next])
+			h.order[h.next] = execution.id
+			h.next = (h.next + 1) % h.retention
+		}
+		h.entries[execution.id] = entry
+	}
+	entry.State = state
+	if len(entry.Transitions) == historyTransitions {
+		head := historyTransitions / 2
+		entry.Transitions = append(entry.Transitions[:head], entry.Transitions[head+1:]...)
+		entry.Elided++
+	}
+	entry.Transitions = append(entry.Transitions, Transition{
+		State:     state,
+		Actor:     actor,
+		Reason:    reason,
+		Tick:      tick,
+		Timestamp: time.Now().UnixMilli(),
+	})
+}
+
+// get returns a copy of the history of the execution
+func (h *historyLog) get(id uuid.UUID) (ExecutionHistory, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	entry, ok := h.entries[id]
+	if !ok {
+		return ExecutionHistory{}, false
+	}
+	history := *entry
+	history.Transitions = append([]Transition(nil), entry.Transitions...)
+	return history, true
+}
+
+// transition records a change of state of the execution, if the history is kept
+func (q *Queue) transition(execution *Execution, state ExecutionState, actor Actor, reason string) {
+	if q.history != nil {
+		q.history.record(execution, state, actor, reason, q.ticks)
+	}
+}
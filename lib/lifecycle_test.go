@@ -0,0 +1,111 @@
+package lib
+
+import (
+	"github.com/google/uuid"
+)
+
+func historyStates(history ExecutionHistory) []ExecutionState {
+	states := make([]ExecutionState, len(history.Transitions))
+	for i, transition := range history.Transitions {
+		states[i] = transition.State
+	}
+	return states
+}
+
+func (s *TestSuite) TestExecutionLifecycle() {
+	query := getQuery(CPU)
+	query.priority = PriorityLow
+	queue := newQueue([]*Query{query}, &[]float64{1}, 1)
+	queue.history = newHistoryLog(10)
+	arrived, _ := queue.tick(1)
+	s.Require().Len(arrived, 1)
+	execution := arrived[0]
+	(*queue.probs)[0] = 0
+
+	s.NoError(queue.delay(execution.id, 2))
+	var executed []*Execution
+	for tick := 0; tick < 3 && len(executed) == 0; tick++ {
+		_, executed = queue.tick(1)
+	}
+	s.Equal([]*Execution{execution}, executed)
+	running := newRunSet()
+	running.history = queue.history
+	running.start(executed)
+	running.tick()
+
+	history, ok := queue.history.get(execution.id)
+	s.True(ok)
+	s.Equal(StateCompleted, history.State)
+	s.Equal([]ExecutionState{StateQueued, StateDelayed, StateDue, StateRunning, StateCompleted}, historyStates(history))
+	s.Equal(ActorDelayAPI, history.Transitions[1].Actor)
+	s.Equal("2 ticks", history.Transitions[1].Reason)
+	s.Equal(1, history.Transitions[0].Tick)
+	s.Equal(4, history.Transitions[3].Tick)
+}
+
+func (s *TestSuite) TestLifecyclePolicies() {
+	query := getQuery(CPU)
+	query.priority = PriorityLow
+	query.maxLatency = 2
+	queue := newQueue([]*Query{query}, &[]float64{1}, 1)
+	queue.history = newHistoryLog(10)
+	queue.scheduler = holdScheduler{}
+	arrived, _ := queue.tick(1)
+	s.Require().Len(arrived, 1)
+	(*queue.probs)[0] = 0
+
+	// Held by the scheduler until its deadline, when it is forced to run
+	queue.tick(1)
+	_, executed := queue.tick(1)
+	s.Len(executed, 1)
+	history, _ := queue.history.get(arrived[0].id)
+	s.Equal([]ExecutionState{StateQueued, StateDue, StateDelayed, StateDue, StateRunning}, historyStates(history))
+	s.Equal(Transition{State: StateDelayed, Actor: ActorScheduler, Reason: "deferred", Tick: 2}, withoutTimestamp(history.Transitions[2]))
+	s.Equal(Transition{State: StateRunning, Actor: ActorPolicy, Reason: "deadline", Tick: 3}, withoutTimestamp(history.Transitions[4]))
+}
+
+func withoutTimestamp(transition Transition) Transition {
+	transition.Timestamp = 0
+	return transition
+}
+
+func (s *TestSuite) TestHistoryRetention() {
+	history := newHistoryLog(2)
+	query := getQuery(CPU)
+	executions := []*Execution{
+		newExecution(query, uuid.New(), 1),
+		newExecution(query, uuid.New(), 1),
+		newExecution(query, uuid.New(), 1),
+	}
+	for _, execution := range executions {
+		history.record(execution, StateQueued, ActorDefault, "", 1)
+	}
+	history.record(executions[1], StateRunning, ActorDefault, "", 2)
+
+	_, ok := history.get(executions[0].id)
+	s.False(ok)
+	second, ok := history.get(executions[1].id)
+	s.True(ok)
+	s.Equal(StateRunning, second.State)
+	s.Len(second.Transitions, 2)
+	_, ok = history.get(executions[2].id)
+	s.True(ok)
+}
+
+func (s *TestSuite) TestHistoryTransitionsBounded() {
+	history := newHistoryLog(1)
+	execution := newExecution(getQuery(CPU), uuid.New(), 1)
+	history.record(execution, StateQueued, ActorDefault, "", 0)
+	for tick := 1; tick <= 100; tick++ {
+		history.record(execution, StateDue, ActorDefault, "", tick)
+		history.record(execution, StateDelayed, ActorScheduler, "deferred", tick)
+	}
+	history.record(execution, StateRunning, ActorDefault, "", 101)
+
+	entry, _ := history.get(execution.id)
+	s.Len(entry.Transitions, historyTransitions)
+	s.Equal(202-historyTransitions, entry.Elided)
+	s.Equal(Transition{State: StateQueued, Actor: ActorDefault, Tick: 0}, withoutTimestamp(entry.Transitions[0]))
+	s.Equal(Transition{State: StateRunning, Actor: ActorDefault, Tick: 101}, withoutTimestamp(entry.Transitions[historyTransitions-1]))
+	s.Equal(StateRunning, entry.State)
+}
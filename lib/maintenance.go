@@ -0,0 +1,175 @@
+package lib
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/google/uuid"
+)
+
+// ExecutionKind distinguishes foreground queries from background work
+type ExecutionKind string
+
+const (
+	KindQuery       ExecutionKind = "query"       // a query arriving from the workload
+	KindMaintenance ExecutionKind = "maintenance" // a background maintenance task such as a vacuum or compaction
+)
+
+// MaintenanceConfig controls the background maintenance tasks, which run for long with large
+// footprints and must finish within a window of arriving
+type MaintenanceConfig struct {
+	Rate  float64           `json:"rate"`  // Rate is the chance per tick of a new task, 0 to disable maintenance
+	Tasks []MaintenanceTask `json:"tasks"` // Tasks are the kinds of task, one of which is picked at random for each arrival
+}
+
+// MaintenanceTask is a kind of maintenance task
+type MaintenanceTask struct {
+	Name     string    `json:"name"`
+	ID       uuid.UUID `json:"id"`       // ID is the ID of the task's query template, derived from the name if omitted
+	Usage    Resources `json:"usage"`    // Usage is the usage of the task on each tick of work, by resource
+	Duration int       `json:"duration"` // Duration is the number of ticks of work the task takes
+	Window   int       `json:"window"`   // Window is the number of ticks after arriving by which the task must finish
+}
+
+func defaultMaintenanceConfig() MaintenanceConfig {
+	return MaintenanceConfig{
+		Tasks: []MaintenanceTask{
+			{Name: "vacuum", Usage: Resources{ResourceCPU: 50, ResourceMemory: 150, ResourceIO: 400}, Duration: 200, Window: 2000},
+			{Name: "compaction", Usage: Resources{ResourceCPU: 150, ResourceMemory: 300, ResourceIO: 300}, Duration: 400, Window: 4000},
+		},
+	}
+}
+
+func (c MaintenanceConfig) validate() error {
+	if c.Rate < 0 || c.Rate > 1 {
+		return fmt.Errorf("maintenance rate must be between 0 and 1")
+	}
+	if c.Rate > 0 && len(c.Tasks) == 0 {
+		return fmt.Errorf("maintenance needs at least one task")
+	}
+	seen := make(map[string]bool, len(c.Tasks))
+	for _, task := range c.Tasks {
+		if task.Name == "" || seen[task.Name] {
+			return fmt.Errorf("maintenance tasks need a unique name")
+		}
+		seen[task.Name] = true
+		if task.Duration < 1 {
+			return fmt.Errorf("maintenance task %s must have a duration of at least 1 tick", task.Name)
+		}
+		if task.Window < task.Duration {
+			return fmt.Errorf("maintenance task %s must have a window of at least its duration", task.Name)
+		}
+		for name, usage := range task.Usage {
+			if usage < 0 {
+				return fmt.Errorf("maintenance task %s must not have a negative %s usage", task.Name, name)
+			}
+		}
+	}
+	return nil
+}
+
+func (c MaintenanceConfig) enabled() bool {
+	return c.Rate > 0
+}
+
+// maintenance generates the maintenance tasks
+type maintenance struct {
+	rate      float64
+	tasks     []MaintenanceTask
+	templates []*Query
+}
+
+// newMaintenance builds the query template of each task. A task is low priority so schedulers may
+// defer it, with a deadline on the latest tick it can start and still finish within its window.
+func newMaintenance(cfg MaintenanceConfig) *maintenance {
+	m := &maintenance{rate: cfg.Rate, tasks: cfg.Tasks}
+	for _, task := range cfg.Tasks {
+		id := task.ID
+		if id == uuid.Nil {
+			id = uuid.NewSHA1(catalogNamespace, []byte(task.Name))
+		}
+		m.templates = append(m.templates, &Query{
+			id:         id,
+			name:       task.Name,
+			profile:    inferProfile(task.Usage),
+			duration:   task.Duration,
+			shape:      FlatShape,
+			usage:      task.Usage.clone(),
+			priority:   PriorityLow,
+			maxLatency: max(1, task.Window-task.Duration),
+			tenant:     DefaultTenant,
+		})
+	}
+	return m
+}
+
+// arrivals returns a new task with the configured chance
+func (m *maintenance) arrivals(rng randSource, tick int, delay int) []*Execution {
+	if rng.Float64() >= m.rate {
+		return nil
+	}
+	i := rng.Intn(len(m.tasks))
+	execution := newExecution(m.templates[i], newRandomID(rng), delay)
+	execution.kind = KindMaintenance
+	execution.finishBy = tick + m.tasks[i].Window
+	return []*Execution{execution}
+}
+
+// Throttler is implemented by schedulers that pace the maintenance tasks in flight, for example
+// to run them in the valleys of the load curve. On every tick it is given the tasks running and
+// returns the rate each runs at, from 0 to pause it to 1 for full speed. Tasks it leaves out run
+// at full speed, as does a task with no slack left, so that it still finishes within its window.
+type Throttler interface {
+	Throttle(running []RunningMaintenance) map[uuid.UUID]float64
+}
+
+// RunningMaintenance is a maintenance task in flight, as seen by a Throttler
+type RunningMaintenance struct {
+	Execution *Execution
+	Remaining float64 // Remaining is the ticks of work left at full speed
+	Slack     int     // Slack is the number of ticks the task can still be paused for and finish within its window
+}
+
+// slack is the number of ticks the execution can pause for and still finish by its finishBy tick,
+// running at full speed from the given tick on
+func (r *runningExecution) slack(now int) int {
+	remaining := float64(r.execution.duration) - r.progress
+	return r.execution.finishBy - (now + int(math.Ceil(remaining-1e-9)) - 1)
+}
+
+// throttle asks the throttler for the rate of each maintenance task in flight. Queries always run at full speed.
+func (r *runSet) throttle() []float64 {
+	rates := make([]float64, len(r.running))
+	for i := range rates {
+		rates[i] = 1
+	}
+	if r.throttler == nil {
+		return rates
+	}
+
+	tasks := make([]RunningMaintenance, 0)
+	indices := make([]int, 0)
+	for i, run := range r.running {
+		if run.execution.kind == KindMaintenance {
+			tasks = append(tasks, RunningMaintenance{
+				Execution: run.execution,
+				Remaining: float64(run.execution.duration) - run.progress,
+				Slack:     run.slack(r.now),
+			})
+			indices = append(indices, i)
+		}
+	}
+	if len(tasks) == 0 {
+		return rates
+	}
+
+	throttled := r.throttler.Throttle(tasks)
+	for j, i := range indices {
+		rate, ok := throttled[tasks[j].Execution.id]
+		if !ok || tasks[j].Slack <= 0 {
+			continue
+		}
+		rates[i] = math.Max(0, math.Min(1, rate))
+	}
+	return rates
+}
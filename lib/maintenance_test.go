@@ -0,0 +1,101 @@
+package lib
+
+import (
+	"github.com/google/uuid"
+)
+
+// pauseThrottler pauses every maintenance task it is given
+type pauseThrottler struct {
+	seen []RunningMaintenance
+}
+
+func (t *pauseThrottler) Throttle(running []RunningMaintenance) map[uuid.UUID]float64 {
+	t.seen = running
+	rates := make(map[uuid.UUID]float64, len(running))
+	for _, task := range running {
+		rates[task.Execution.ID()] = 0
+	}
+	return rates
+}
+
+func (s *TestSuite) TestMaintenanceArrivals() {
+	cfg := defaultMaintenanceConfig()
+	cfg.Rate = 1
+	s.Require().NoError(cfg.validate())
+	probs := []float64{0}
+	queue := newQueue(getQueries(1), &probs, 1)
+	queue.maintenance = newMaintenance(cfg)
+	queue.queries = addTemplates(queue.queries, queue.probs, queue.maintenance.templates)
+	queue.cache = newQueryCache(CacheConfig{Capacity: 10, HitCost: 0.1, Resource: ResourceIO})
+	s.Len(queue.queries, 3)
+
+	arrived, _ := queue.tick(1)
+	s.Require().Len(arrived, 1)
+	task := arrived[0]
+	s.Equal(KindMaintenance, task.Kind())
+	s.Equal(PriorityLow, task.Priority())
+	window := 2000
+	if task.query.name == "compaction" {
+		window = 4000
+	}
+	s.Equal(1+window, task.FinishBy())
+	s.Equal(1+window-task.query.duration, task.Deadline())
+
+	_, executed := queue.tick(1)
+	s.Contains(executed, task)
+	s.Equal(CacheStats{}, queue.cache.totals())
+}
+
+func (s *TestSuite) TestThrottleMaintenance() {
+	query := &Query{shape: FlatShape}
+	throttler := &pauseThrottler{}
+	running := newRunSet()
+	running.throttler = throttler
+	running.semantics = defaultSemanticsConfig()
+	task := &Execution{query: query, id: uuid.New(), kind: KindMaintenance, duration: 2, finishBy: 4, usage: Resources{ResourceCPU: 10, ResourceMemory: 20}}
+	other := &Execution{query: query, id: uuid.New(), kind: KindQuery, duration: 4, usage: Resources{ResourceCPU: 1}}
+	running.start([]*Execution{task, other})
+
+	// Paused, the task holds its memory but uses no CPU
+	running.now = 1
+	s.Equal(ResourceUpdate{Usage: Resources{ResourceCPU: 1, ResourceMemory: 20}, Running: 2, Throttled: 1}, running.tick())
+	s.Require().Len(throttler.seen, 1)
+	s.Equal(2.0, throttler.seen[0].Remaining)
+	s.Equal(2, throttler.seen[0].Slack)
+
+	running.now = 2
+	running.tick()
+	s.Equal(1, throttler.seen[0].Slack)
+
+	// Out of slack, the task runs at full speed regardless of the throttler
+	running.now = 3
+	s.Equal(ResourceUpdate{Usage: Resources{ResourceCPU: 11, ResourceMemory: 20}, Running: 2}, running.tick())
+	s.Equal(0, throttler.seen[0].Slack)
+	running.now = 4
+	running.tick()
+	s.Empty(running.usage())
+}
+
+func (s *TestSuite) TestMaintenanceConfig() {
+	s.NoError(defaultMaintenanceConfig().validate())
+
+	cfg := defaultMaintenanceConfig()
+	cfg.Rate = 1.5
+	s.Error(cfg.validate())
+
+	cfg = MaintenanceConfig{Rate: 0.1}
+	s.Error(cfg.validate())
+
+	cfg = defaultMaintenanceConfig()
+	cfg.Tasks[0].Window = cfg.Tasks[0].Duration - 1
+	s.Error(cfg.validate())
+
+	cfg = defaultMaintenanceConfig()
+	cfg.Tasks[1].Name = cfg.Tasks[0].Name
+	s.Error(cfg.validate())
+
+	config := DefaultConfig()
+	config.Maintenance.Rate = 0.01
+	config.Trace.Record = "trace.ndjson"
+	s.NoError(config.validate())
+}
@@ -1,20 +1,37 @@
 package lib
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/rs/zerolog"
 )
 
 type Monitor struct {
-	cpuUsage        []int
-	memoryUsage     []int
-	ioUsage         []int
+	dimensions      []string         // dimensions are the resources tracked, in the order they are reported
+	semantics       SemanticsConfig  // semantics decides which resources report the total moved
+	usage           map[string][]int // usage holds the per-tick usage of each resource since the last aggregation
+	tenants         []string         // tenants are the tenants whose usage is tracked, nil unless tenants are configured
+	tenantUsage     map[string]map[string][]int
+	lastTenants     map[string]map[string]ResourceUsage
+	running         []int
+	throttled       []int
+	depth           []int
 	lastUpdate      time.Time
-	lastCpu         ResourceUsage
-	lastMemory      ResourceUsage
-	lastIo          ResourceUsage
+	lastUsage       map[string]ResourceUsage
+	lastDimensions  []string
+	lastRunning     ResourceUsage
+	lastThrottled   ResourceUsage
+	lastDepth       ResourceUsage
+	queueStats      QueueStats
+	lastQueue       QueueStats
+	cacheStats      CacheStats
+	lastCache       CacheStats
+	mu              sync.Mutex // mu guards the last aggregated metrics, which are read while the monitor runs
 	updateFrequency time.Duration
 	tickrate        int
 }
@@ -23,41 +40,121 @@ type ResourceUsage struct {
 	Average int `json:"average"`
 	Min     int `json:"min"`
 	Max     int `json:"max"`
+	Total   int `json:"total,omitempty"` // Total is the volume moved over the interval, for throughput resources
 }
 
 type ResourceUpdate struct {
-	CPU    int
-	Memory int
-	IO     int
+	Usage     Resources
+	Running   int // Running is the number of executions in flight during the tick
+	Throttled int // Throttled is the number of executions slowed down by saturation during the tick
+	Depth     int // Depth is the number of executions queued at the end of the tick
+	Queue     QueueStats
+	Cache     CacheStats
+	Tenants   map[string]Resources // Tenants splits the usage by tenant, if tenants are configured
 }
 
-// ResourceMetrics represents the resource utilization metrics
+// ResourceMetrics represents the resource utilization metrics.
+// Each resource is a top-level field of its JSON, alongside running, throttled, depth, queue, cache, tenants and timestamp.
 type ResourceMetrics struct {
-	CPU       ResourceUsage `json:"cpu"`
-	IO        ResourceUsage `json:"io"`
-	Memory    ResourceUsage `json:"memory"`
-	Timestamp int64         `json:"timestamp"`
+	Resources  map[string]ResourceUsage            `json:"-"`
+	Running    ResourceUsage                       `json:"running"`
+	Throttled  ResourceUsage                       `json:"throttled"`
+	Depth      ResourceUsage                       `json:"depth"`
+	Queue      QueueStats                          `json:"queue"`
+	Cache      CacheStats                          `json:"cache"`
+	Tenants    map[string]map[string]ResourceUsage `json:"tenants,omitempty"` // Tenants is the usage of each resource by tenant, if tenants are configured
+	Timestamp  int64                               `json:"timestamp"`
+	dimensions []string
+}
+
+// Dimensions lists the resources in the order they are reported
+func (r ResourceMetrics) Dimensions() []string {
+	if r.dimensions == nil {
+		return resourceNames(r.Resources)
+	}
+	return r.dimensions
+}
+
+func (r ResourceMetrics) MarshalJSON() ([]byte, error) {
+	type plain ResourceMetrics
+	return marshalFlattened(r.Resources, r.Dimensions(), plain(r))
+}
+
+// UnmarshalJSON reads every field other than running, throttled, depth, queue, cache, tenants and timestamp as a resource, keeping their order
+func (r *ResourceMetrics) UnmarshalJSON(data []byte) error {
+	type plain ResourceMetrics
+	var decoded plain
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	decoded.Resources = make(map[string]ResourceUsage)
+	decoded.dimensions = make([]string, 0)
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if _, err := decoder.Token(); err != nil {
+		return err
+	}
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		name := key.(string)
+		if slices.Contains(reservedResourceNames, name) {
+			var skip json.RawMessage
+			if err := decoder.Decode(&skip); err != nil {
+				return err
+			}
+			continue
+		}
+		var usage ResourceUsage
+		if err := decoder.Decode(&usage); err != nil {
+			return fmt.Errorf("invalid %s: %w", name, err)
+		}
+		decoded.Resources[name] = usage
+		decoded.dimensions = append(decoded.dimensions, name)
+	}
+	*r = ResourceMetrics(decoded)
+	return nil
 }
 
 func (r ResourceMetrics) MarshalZerologObject(log *zerolog.Event) {
-	log.Str("CPU", fmt.Sprintf("avg: %d, min: %d, max: %d", r.CPU.Average, r.CPU.Min, r.CPU.Max))
-	log.Str("IO", fmt.Sprintf("avg: %d, min: %d, max: %d", r.IO.Average, r.IO.Min, r.IO.Max))
-	log.Str("Memory", fmt.Sprintf("avg: %d, min: %d, max: %d", r.Memory.Average, r.Memory.Min, r.Memory.Max))
+	for _, name := range r.Dimensions() {
+		usage := r.Resources[name]
+		log.Str(name, fmt.Sprintf("avg: %d, min: %d, max: %d", usage.Average, usage.Min, usage.Max))
+	}
+	log.Str("Running", fmt.Sprintf("avg: %d, min: %d, max: %d", r.Running.Average, r.Running.Min, r.Running.Max))
+	log.Str("Throttled", fmt.Sprintf("avg: %d, min: %d, max: %d", r.Throttled.Average, r.Throttled.Min, r.Throttled.Max))
+	log.Str("Depth", fmt.Sprintf("avg: %d, min: %d, max: %d", r.Depth.Average, r.Depth.Min, r.Depth.Max))
+	log.Int("Carried", r.Queue.Carried)
+	log.Int("Expired", r.Queue.Expired)
+	log.Int("Forced", r.Queue.ForcedRun)
+	log.Int("Dropped", r.Queue.Dropped)
+	log.Int("Evicted", r.Queue.Evicted)
+	log.Int("Overflow", r.Queue.Overflow)
+	log.Int("CacheHits", r.Cache.Hits)
+	log.Int("CacheMisses", r.Cache.Misses)
 	log.Time("Timestamp", time.UnixMilli(r.Timestamp))
 }
 
-func newMonitor(updateFrequency time.Duration, tickrate int) *Monitor {
-	return &Monitor{
-		cpuUsage:        make([]int, 0),
-		memoryUsage:     make([]int, 0),
-		ioUsage:         make([]int, 0),
+func newMonitor(updateFrequency time.Duration, tickrate int, dimensions []string) *Monitor {
+	m := &Monitor{
+		dimensions:      slices.Clone(dimensions),
+		usage:           make(map[string][]int),
+		running:         make([]int, 0),
+		throttled:       make([]int, 0),
+		depth:           make([]int, 0),
 		lastUpdate:      time.Now(),
-		lastCpu:         ResourceUsage{0, 0, 0},
-		lastMemory:      ResourceUsage{0, 0, 0},
-		lastIo:          ResourceUsage{0, 0, 0},
+		lastUsage:       make(map[string]ResourceUsage),
+		lastDimensions:  slices.Clone(dimensions),
 		updateFrequency: updateFrequency,
 		tickrate:        tickrate,
 	}
+	for _, name := range dimensions {
+		m.usage[name] = make([]int, 0)
+		m.lastUsage[name] = ResourceUsage{}
+	}
+	return m
 }
 
 func (m *Monitor) run(resourceUpdateChan <-chan ResourceUpdate) {
@@ -69,39 +166,125 @@ func (m *Monitor) run(resourceUpdateChan <-chan ResourceUpdate) {
 		case <-ticker.C:
 			m.aggregate()
 		case update := <-resourceUpdateChan:
-			m.update(update.CPU, update.Memory, update.IO)
+			m.update(update.Usage)
+			m.updateTenants(update.Tenants)
+			m.running = append(m.running, update.Running)
+			m.throttled = append(m.throttled, update.Throttled)
+			m.depth = append(m.depth, update.Depth)
+			m.queueStats.add(update.Queue)
+			m.cacheStats.add(update.Cache)
 		}
 	}
 }
 
 func (m *Monitor) aggregate() {
-	m.lastCpu = getResourceStats(m.cpuUsage)
-	m.lastMemory = getResourceStats(m.memoryUsage)
-	m.lastIo = getResourceStats(m.ioUsage)
+	lastUsage := make(map[string]ResourceUsage, len(m.dimensions))
+	for _, name := range m.dimensions {
+		lastUsage[name] = m.resourceStats(name, m.usage[name])
+		m.usage[name] = make([]int, 0)
+	}
+	var lastTenants map[string]map[string]ResourceUsage
+	if m.tenants != nil {
+		lastTenants = make(map[string]map[string]ResourceUsage, len(m.tenants))
+		for _, tenant := range m.tenants {
+			lastTenants[tenant] = make(map[string]ResourceUsage, len(m.dimensions))
+			for _, name := range m.dimensions {
+				lastTenants[tenant][name] = m.resourceStats(name, m.tenantUsage[tenant][name])
+			}
+			m.tenantUsage[tenant] = make(map[string][]int)
+		}
+	}
+
+	m.mu.Lock()
+	m.lastUsage = lastUsage
+	m.lastTenants = lastTenants
+	m.lastDimensions = slices.Clone(m.dimensions)
+	m.lastRunning = getResourceStats(m.running)
+	m.lastThrottled = getResourceStats(m.throttled)
+	m.lastDepth = getResourceStats(m.depth)
+	m.lastQueue = m.queueStats
+	m.lastCache = m.cacheStats
 	m.lastUpdate = time.Now()
-	m.cpuUsage = make([]int, 0)
-	m.memoryUsage = make([]int, 0)
-	m.ioUsage = make([]int, 0)
+	m.mu.Unlock()
+
+	m.queueStats = QueueStats{}
+	m.cacheStats = CacheStats{}
+	m.running = make([]int, 0)
+	m.throttled = make([]int, 0)
+	m.depth = make([]int, 0)
+}
+
+// update records the usage of a tick. A resource not seen before, such as one used only by a
+// template introduced during the run, is tracked from then on.
+func (m *Monitor) update(usage Resources) {
+	for name := range usage {
+		if _, ok := m.usage[name]; !ok {
+			m.dimensions = append(m.dimensions, name)
+			m.usage[name] = make([]int, 0)
+		}
+	}
+	for _, name := range m.dimensions {
+		m.usage[name] = append(m.usage[name], usage[name])
+	}
 }
 
-func (m *Monitor) update(cpuUsage int, memoryUsage int, ioUsage int) {
-	m.cpuUsage = append(m.cpuUsage, cpuUsage)
-	m.memoryUsage = append(m.memoryUsage, memoryUsage)
-	m.ioUsage = append(m.ioUsage, ioUsage)
+// updateTenants records the usage of each tenant in a tick. Tenants without executions in flight use 0.
+func (m *Monitor) updateTenants(usage map[string]Resources) {
+	if m.tenants == nil {
+		return
+	}
+	for tenant := range usage {
+		if _, ok := m.tenantUsage[tenant]; !ok {
+			m.tenants = append(m.tenants, tenant)
+			m.tenantUsage[tenant] = make(map[string][]int)
+		}
+	}
+	for _, tenant := range m.tenants {
+		for _, name := range m.dimensions {
+			m.tenantUsage[tenant][name] = append(m.tenantUsage[tenant][name], usage[tenant][name])
+		}
+	}
+}
+
+// resourceStats summarizes the per-tick usage of a resource, with the total moved for throughput resources
+func (m *Monitor) resourceStats(name string, usage []int) ResourceUsage {
+	stats := getResourceStats(usage)
+	if m.semantics.of(name) == ThroughputResource {
+		for _, value := range usage {
+			stats.Total += value
+		}
+	}
+	return stats
+}
+
+// trackTenants splits the usage by the given tenants from now on
+func (m *Monitor) trackTenants(tenants []string) {
+	m.tenants = slices.Clone(tenants)
+	m.tenantUsage = make(map[string]map[string][]int, len(tenants))
+	for _, tenant := range tenants {
+		m.tenantUsage[tenant] = make(map[string][]int)
+	}
 }
 
 func (m *Monitor) getResources() *ResourceMetrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	return &ResourceMetrics{
-		Timestamp: m.lastUpdate.UnixMilli(),
-		CPU:       m.lastCpu,
-		Memory:    m.lastMemory,
-		IO:        m.lastIo,
+		Timestamp:  m.lastUpdate.UnixMilli(),
+		Resources:  m.lastUsage,
+		Running:    m.lastRunning,
+		Throttled:  m.lastThrottled,
+		Depth:      m.lastDepth,
+		Queue:      m.lastQueue,
+		Cache:      m.lastCache,
+		Tenants:    m.lastTenants,
+		dimensions: m.lastDimensions,
 	}
 }
 
 func getResourceStats(usage []int) ResourceUsage {
 	if len(usage) == 0 {
-		return ResourceUsage{0, 0, 0}
+		return ResourceUsage{}
 	}
 
 	min := usage[0]
@@ -119,5 +302,5 @@ func getResourceStats(usage []int) ResourceUsage {
 	}
 
 	avg := sum / len(usage)
-	return ResourceUsage{avg, min, max}
+	return ResourceUsage{Average: avg, Min: min, Max: max}
 }
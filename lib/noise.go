@@ -0,0 +1,120 @@
+package lib
+
+import (
+	"fmt"
+	"math"
+	"os"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	NoNoise       = "none"     // every execution uses exactly its query's usage
+	NormalNoise   = "normal"   // symmetric noise
+	SkewNormNoise = "skewnorm" // skewed noise, with a long tail on the side of Skew
+	UniformNoise  = "uniform"  // bounded noise
+)
+
+// NoiseConfig controls how much an execution's usage varies around its query's usage
+type NoiseConfig struct {
+	Distribution string  `json:"distribution"` // Distribution is the name of the noise distribution
+	Spread       float64 `json:"spread"`       // Spread is the standard deviation of the usage, relative to the query's usage
+	Skew         float64 `json:"skew"`         // Skew is the skewness parameter of the skewnorm distribution
+	Correlation  float64 `json:"correlation"`  // Correlation is how strongly the noise is shared across resources, from 0 to 1
+	Log          string  `json:"log"`          // Log is a file the usage of every execution is written to, otherwise it goes to the debug log
+}
+
+func defaultNoiseConfig() NoiseConfig {
+	return NoiseConfig{Distribution: NoNoise}
+}
+
+func (c NoiseConfig) validate() error {
+	switch c.Distribution {
+	case NoNoise, NormalNoise, SkewNormNoise, UniformNoise:
+	default:
+		return fmt.Errorf("unknown noise distribution %q", c.Distribution)
+	}
+	if c.Spread < 0 {
+		return fmt.Errorf("noise spread must not be negative")
+	}
+	if c.Correlation < 0 || c.Correlation > 1 {
+		return fmt.Errorf("noise correlation must be between 0 and 1")
+	}
+	return nil
+}
+
+// enabled reports whether executions' usage varies around their query's usage
+func (c NoiseConfig) enabled() bool {
+	return c.Distribution != NoNoise && c.Spread > 0
+}
+
+// noise draws each execution's usage and records it as ground truth
+type noise struct {
+	cfg    NoiseConfig
+	logger zerolog.Logger
+	toFile bool // toFile is set when the ground truth goes to its own file, which ignores the global log level
+}
+
+func newNoise(cfg NoiseConfig) (*noise, error) {
+	n := &noise{cfg: cfg, logger: log.Logger}
+	if cfg.Log != "" {
+		file, err := os.OpenFile(cfg.Log, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+		n.logger = zerolog.New(file).With().Timestamp().Logger()
+		n.toFile = true
+	}
+	return n, nil
+}
+
+// apply sets the usage of the execution and logs it along with its query's usage
+func (n *noise) apply(rng randSource, execution *Execution) {
+	query := execution.query
+	execution.usage = query.usage.clone()
+
+	if n.cfg.enabled() {
+		common := n.standard(rng)
+		for _, name := range query.usage.names() {
+			execution.usage[name] = n.vary(rng, query.usage[name], common)
+		}
+	}
+	n.log(execution)
+}
+
+// log records the usage of the execution along with its query's
+func (n *noise) log(execution *Execution) {
+	query := execution.query
+	event := n.logger.Debug()
+	if n.toFile {
+		event = n.logger.Log()
+	}
+	event.
+		Str("Execution", execution.id.String()).
+		Str("Query", query.id.String()).
+		Object("Usage", execution.usage).
+		Int("Duration", execution.duration).
+		Object("QueryUsage", query.usage).
+		Msg("Execution usage")
+}
+
+// vary draws a usage around mean, mixing the noise shared across resources with noise of its own
+func (n *noise) vary(rng randSource, mean int, common float64) int {
+	z := math.Sqrt(n.cfg.Correlation)*common + math.Sqrt(1-n.cfg.Correlation)*n.standard(rng)
+	return max(0, int(math.Round(float64(mean)*(1+n.cfg.Spread*z))))
+}
+
+// standard draws from the configured distribution, standardized to a mean of 0 and a variance of 1
+func (n *noise) standard(rng randSource) float64 {
+	switch n.cfg.Distribution {
+	case SkewNormNoise:
+		delta := n.cfg.Skew / math.Sqrt(1+n.cfg.Skew*n.cfg.Skew)
+		mean := delta * math.Sqrt(2/math.Pi)
+		return (skewNorm(rng, 0, 1, n.cfg.Skew) - mean) / math.Sqrt(1-mean*mean)
+	case UniformNoise:
+		return (rng.Float64()*2 - 1) * math.Sqrt(3)
+	default:
+		return rng.NormFloat64()
+	}
+}
@@ -0,0 +1,98 @@
+package lib
+
+import (
+	"bufio"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+func (s *TestSuite) TestNoiseIsStandardized() {
+	for _, distribution := range []string{NormalNoise, SkewNormNoise, UniformNoise} {
+		n := &noise{cfg: NoiseConfig{Distribution: distribution, Skew: 5}}
+		mean, variance := 0.0, 0.0
+		samples := make([]float64, 100000)
+		for i := range samples {
+			samples[i] = n.standard(processRand{})
+			mean += samples[i]
+		}
+		mean /= float64(len(samples))
+		for _, sample := range samples {
+			variance += (sample - mean) * (sample - mean)
+		}
+		variance /= float64(len(samples))
+		s.InDelta(0, mean, 0.02, distribution)
+		s.InDelta(1, variance, 0.03, distribution)
+	}
+}
+
+func (s *TestSuite) TestNoiseCorrelation() {
+	query := &Query{usage: Resources{ResourceCPU: 100, ResourceMemory: 100, ResourceIO: 100}}
+	correlation := func(rho float64) float64 {
+		n := &noise{cfg: NoiseConfig{Distribution: NormalNoise, Spread: 0.2, Correlation: rho}, logger: zerolog.Nop()}
+		sumXY, sumX, sumY, sumXX, sumYY := 0.0, 0.0, 0.0, 0.0, 0.0
+		count := 20000.0
+		for i := 0; i < int(count); i++ {
+			execution := &Execution{query: query}
+			n.apply(processRand{}, execution)
+			x, y := float64(execution.usage[ResourceCPU]), float64(execution.usage[ResourceIO])
+			sumXY += x * y
+			sumX += x
+			sumY += y
+			sumXX += x * x
+			sumYY += y * y
+		}
+		cov := sumXY/count - sumX*sumY/(count*count)
+		return cov / math.Sqrt((sumXX/count-sumX*sumX/(count*count))*(sumYY/count-sumY*sumY/(count*count)))
+	}
+
+	s.InDelta(0, correlation(0), 0.05)
+	s.InDelta(0.8, correlation(0.8), 0.05)
+}
+
+func (s *TestSuite) TestNoNoiseKeepsQueryUsage() {
+	query := &Query{usage: Resources{ResourceCPU: 70, ResourceMemory: 30, ResourceIO: 20, "network": 5}}
+	n := &noise{cfg: defaultNoiseConfig(), logger: zerolog.Nop()}
+	execution := &Execution{query: query}
+	n.apply(processRand{}, execution)
+	s.Equal(query.usage, execution.usage)
+}
+
+func (s *TestSuite) TestNoiseConfigValidation() {
+	s.NoError(defaultNoiseConfig().validate())
+	s.Error(NoiseConfig{Distribution: "cauchy"}.validate())
+	s.Error(NoiseConfig{Distribution: NormalNoise, Spread: -1}.validate())
+
+	cfg := DefaultConfig()
+	cfg.Noise = NoiseConfig{Distribution: NormalNoise, Spread: 0.2}
+	s.NoError(cfg.validate())
+	cfg.Trace.Replay = "trace.ndjson"
+	s.NoError(cfg.validate())
+}
+
+func (s *TestSuite) TestNoiseLogsGroundTruth() {
+	path := filepath.Join(s.T().TempDir(), "usage.log")
+	n, err := newNoise(NoiseConfig{Distribution: UniformNoise, Spread: 0.5, Log: path})
+	s.NoError(err)
+
+	query := &Query{id: uuid.New(), usage: Resources{ResourceCPU: 70, ResourceMemory: 30, ResourceIO: 20}}
+	execution := &Execution{query: query, id: uuid.New(), duration: 3}
+	n.apply(processRand{}, execution)
+
+	file, err := os.Open(path)
+	s.NoError(err)
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	s.True(scanner.Scan())
+
+	var entry map[string]any
+	s.NoError(json.Unmarshal(scanner.Bytes(), &entry))
+	s.Equal(execution.id.String(), entry["Execution"])
+	s.Equal(float64(execution.usage[ResourceCPU]), entry["Usage"].(map[string]any)[ResourceCPU])
+	s.Equal(float64(70), entry["QueryUsage"].(map[string]any)[ResourceCPU])
+	s.Equal(float64(3), entry["Duration"])
+}
@@ -0,0 +1,114 @@
+package lib
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Priority is how latency-sensitive a query is
+type Priority int
+
+const (
+	PriorityLow    Priority = iota // batch work that the queue may defer automatically
+	PriorityNormal                 // interactive work that only runs late when explicitly delayed
+	PriorityHigh                   // latency-critical work with a tight delay ceiling
+)
+
+var priorityNames = map[Priority]string{
+	PriorityLow:    "low",
+	PriorityNormal: "normal",
+	PriorityHigh:   "high",
+}
+
+func (p Priority) String() string {
+	if name, ok := priorityNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("priority(%d)", int(p))
+}
+
+func (p Priority) MarshalText() ([]byte, error) {
+	if _, ok := priorityNames[p]; !ok {
+		return nil, fmt.Errorf("unknown priority %d", int(p))
+	}
+	return []byte(p.String()), nil
+}
+
+func (p *Priority) UnmarshalText(text []byte) error {
+	for priority, name := range priorityNames {
+		if name == string(text) {
+			*p = priority
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown priority %q", string(text))
+}
+
+// deferrable reports whether queue policies may defer work of this priority without being asked to
+func (p Priority) deferrable() bool {
+	return p == PriorityLow
+}
+
+// PriorityConfig controls how priorities are assigned to queries and how far they may be delayed
+type PriorityConfig struct {
+	Weights  map[Priority]float64 `json:"weights"`   // Weights is the relative share of generated queries given each priority
+	Assign   map[int]Priority     `json:"assign"`    // Assign fixes the priority of the query template at the given index
+	MaxDelay map[Priority]int     `json:"max_delay"` // MaxDelay is the most ticks that may be added to an execution, 0 for no ceiling
+}
+
+// defaultPriorityConfig keeps every query at normal priority with no delay ceiling, as before priorities existed
+func defaultPriorityConfig() PriorityConfig {
+	return PriorityConfig{}
+}
+
+// assignPriorities draws a priority for each query from the configured weights, then applies any fixed
+// assignments. Without weights, queries keep the normal priority they are generated with.
+func assignPriorities(queries []*Query, cfg PriorityConfig, rng randSource) {
+	priorities := make([]Priority, 0, len(cfg.Weights))
+	total := 0.0
+	for priority, weight := range cfg.Weights {
+		priorities = append(priorities, priority)
+		total += weight
+	}
+	sort.Slice(priorities, func(i, j int) bool { return priorities[i] < priorities[j] })
+
+	for _, query := range queries {
+		draw := rng.Float64() * total
+		for _, priority := range priorities {
+			draw -= cfg.Weights[priority]
+			if draw < 0 {
+				query.priority = priority
+				break
+			}
+		}
+	}
+	for idx, priority := range cfg.Assign {
+		if idx >= 0 && idx < len(queries) {
+			queries[idx].priority = priority
+		}
+	}
+}
+
+// sortByPriority orders executions highest priority first, then oldest first
+func sortByPriority(executions []*Execution) {
+	sort.SliceStable(executions, func(i, j int) bool {
+		if executions[i].priority != executions[j].priority {
+			return executions[i].priority > executions[j].priority
+		}
+		return executions[i].queuedAt < executions[j].queuedAt
+	})
+}
+
+func (c PriorityConfig) validate() error {
+	for priority, weight := range c.Weights {
+		if weight < 0 {
+			return fmt.Errorf("priority weight for %s must not be negative", priority)
+		}
+	}
+	for priority, maxDelay := range c.MaxDelay {
+		if maxDelay < 0 {
+			return fmt.Errorf("max_delay for %s must not be negative", priority)
+		}
+	}
+	return nil
+}
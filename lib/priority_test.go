@@ -0,0 +1,82 @@
+package lib
+
+import (
+	"encoding/json"
+
+	"github.com/google/uuid"
+)
+
+func (s *TestSuite) TestPriorityJSON() {
+	data, err := json.Marshal(map[Priority]int{PriorityHigh: 5})
+	s.NoError(err)
+	s.JSONEq(`{"high": 5}`, string(data))
+
+	var priority Priority
+	s.NoError(json.Unmarshal([]byte(`"low"`), &priority))
+	s.Equal(PriorityLow, priority)
+	s.Error(json.Unmarshal([]byte(`"urgent"`), &priority))
+}
+
+func (s *TestSuite) TestAssignPriorities() {
+	queries := getQueries(1000)
+	assignPriorities(queries, PriorityConfig{
+		Weights: map[Priority]float64{PriorityLow: 1, PriorityHigh: 1},
+		Assign:  map[int]Priority{0: PriorityNormal},
+	}, processRand{})
+
+	counts := make(map[Priority]int)
+	for _, query := range queries {
+		counts[query.priority]++
+	}
+	s.Equal(PriorityNormal, queries[0].priority)
+	s.Equal(1, counts[PriorityNormal])
+	s.InDelta(500, counts[PriorityLow], 100)
+	s.InDelta(500, counts[PriorityHigh], 100)
+}
+
+func (s *TestSuite) TestDelayCeiling() {
+	queue := newQueue(getQueries(1), getExecutionProbs(1), 1)
+	queue.maxDelay = map[Priority]int{PriorityHigh: 5}
+
+	high := &Execution{query: queue.queries[0], id: uuid.New(), delay: 1, priority: PriorityHigh}
+	low := &Execution{query: queue.queries[0], id: uuid.New(), delay: 1, priority: PriorityLow}
+	queue.queued[high.id] = high
+	queue.queued[low.id] = low
+
+	s.NoError(queue.delay(high.id, 3))
+	s.ErrorIs(queue.delay(high.id, 3), ErrDelayCeiling)
+	s.NoError(queue.delay(high.id, 2))
+	s.Equal(6, high.delay)
+	s.NoError(queue.delay(low.id, 1000))
+	s.ErrorIs(queue.delay(uuid.New(), 1), ErrExecutionNotFound)
+
+	// Taking delay back would make room under the ceiling
+	s.ErrorIs(queue.delay(high.id, -5), ErrNegativeDelay)
+	s.Equal(6, high.delay)
+	s.Equal(5, high.addedDelay)
+}
+
+func (s *TestSuite) TestDefaultPriorities() {
+	queries := getQueries(100)
+	assignPriorities(queries, defaultPriorityConfig(), processRand{})
+	for _, query := range queries {
+		s.Equal(PriorityNormal, query.priority)
+	}
+	s.Empty(defaultPriorityConfig().MaxDelay)
+}
+
+func (s *TestSuite) TestQueueRunsNonDeferrable() {
+	queries := getQueries(100)
+	queue := newQueue(queries, getExecutionProbs(100), 1)
+	queue.scheduler = holdScheduler{}
+
+	for i := 0; i < 100; i++ {
+		_, executed := queue.tick(1)
+		for _, execution := range executed {
+			s.NotEqual(PriorityLow, execution.priority)
+		}
+	}
+	for _, execution := range queue.queued {
+		s.True(execution.priority.deferrable() || execution.queuedAt == queue.ticks)
+	}
+}
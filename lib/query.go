@@ -1,14 +1,23 @@
 package lib
 
 import (
+	"fmt"
+	"slices"
+
 	"github.com/google/uuid"
 )
 
 type Query struct {
-	id          uuid.UUID
-	cpuUsage    int
-	memoryUsage int
-	ioUsage     int
+	id         uuid.UUID
+	name       string
+	profile    Profile
+	duration   int        // duration is the mean number of ticks an execution of the query runs for
+	shape      UsageShape // shape is how an execution's usage is spread over the ticks it runs for
+	usage      Resources  // usage is the mean usage of an execution of the query, by resource
+	priority   Priority
+	maxLatency int    // maxLatency overrides the deadline for the query's priority when set, in ticks
+	tenant     string // tenant is the customer the query belongs to
+	write      bool   // write is set for queries that write, which run on the primary of a cluster
 }
 
 // Profile is what the query execution is bound by
@@ -20,31 +29,104 @@ const (
 	Memory
 )
 
+var profileNames = map[Profile]string{
+	CPU:    "cpu",
+	IO:     "io",
+	Memory: "memory",
+}
+
+func (p Profile) String() string {
+	if name, ok := profileNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("profile(%d)", int(p))
+}
+
+func (p Profile) MarshalText() ([]byte, error) {
+	if _, ok := profileNames[p]; !ok {
+		return nil, fmt.Errorf("unknown profile %d", int(p))
+	}
+	return []byte(p.String()), nil
+}
+
+func (p *Profile) UnmarshalText(text []byte) error {
+	for profile, name := range profileNames {
+		if name == string(text) {
+			*p = profile
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown profile %q", string(text))
+}
+
+// inferProfile returns the profile of the built-in resource with the highest usage. Profiles only
+// cover the built-in resources, so a template bound by an extra resource still gets one of them;
+// boundResource names the extra resource instead.
+func inferProfile(usage Resources) Profile {
+	cpuUsage, memoryUsage, ioUsage := usage[ResourceCPU], usage[ResourceMemory], usage[ResourceIO]
+	if ioUsage > cpuUsage && ioUsage >= memoryUsage {
+		return IO
+	}
+	if memoryUsage > cpuUsage {
+		return Memory
+	}
+	return CPU
+}
+
+// boundResource returns the resource the query is bound by: the extra resource it uses most, if it
+// uses more of it than of its profile's resource, and its profile's resource otherwise
+func (q *Query) boundResource() string {
+	bound := q.profile.String()
+	for _, name := range q.usage.names() {
+		if !slices.Contains(builtinResources, name) && q.usage[name] > q.usage[bound] {
+			bound = name
+		}
+	}
+	return bound
+}
+
 func getQuery(profile Profile) *Query {
+	return drawQuery(processRand{}, profile)
+}
+
+// drawQuery generates a query template of the profile, drawing its usage from the source
+func drawQuery(rng randSource, profile Profile) *Query {
 	query := Query{
-		id: uuid.New(),
+		id:       newRandomID(rng),
+		profile:  profile,
+		duration: 1,
+		shape:    FlatShape,
+		priority: PriorityNormal,
+		usage:    make(Resources),
+		tenant:   DefaultTenant,
 	}
 	switch profile {
 	case CPU:
-		query.cpuUsage = int(SkewNorm(70, 15, -10))
-		query.memoryUsage = int(SkewNorm(30, 15, 10))
-		query.ioUsage = int(SkewNorm(30, 15, 10))
+		query.usage[ResourceCPU] = int(skewNorm(rng, 70, 15, -10))
+		query.usage[ResourceMemory] = int(skewNorm(rng, 30, 15, 10))
+		query.usage[ResourceIO] = int(skewNorm(rng, 30, 15, 10))
 	case IO:
-		query.cpuUsage = int(SkewNorm(30, 15, 10))
-		query.memoryUsage = int(SkewNorm(30, 15, 10))
-		query.ioUsage = int(SkewNorm(70, 15, -10))
+		query.usage[ResourceCPU] = int(skewNorm(rng, 30, 15, 10))
+		query.usage[ResourceMemory] = int(skewNorm(rng, 30, 15, 10))
+		query.usage[ResourceIO] = int(skewNorm(rng, 70, 15, -10))
 	case Memory:
-		query.cpuUsage = int(SkewNorm(30, 15, 10))
-		query.memoryUsage = int(SkewNorm(70, 15, -10))
-		query.ioUsage = int(SkewNorm(30, 15, 10))
+		query.usage[ResourceCPU] = int(skewNorm(rng, 30, 15, 10))
+		query.usage[ResourceMemory] = int(skewNorm(rng, 70, 15, -10))
+		query.usage[ResourceIO] = int(skewNorm(rng, 30, 15, 10))
 	}
 	return &query
 }
 
 func getQueries(n int) []*Query {
+	return drawQueries(processRand{}, n)
+}
+
+// drawQueries generates n query templates, cycling through the profiles
+func drawQueries(rng randSource, n int) []*Query {
 	queries := make([]*Query, n)
 	for i := 0; i < n; i++ {
-		queries[i] = getQuery(Profile(i % 3))
+		queries[i] = drawQuery(rng, Profile(i%3))
+		queries[i].name = fmt.Sprintf("%s-%d", queries[i].profile, i)
 	}
 	return queries
 }
@@ -6,9 +6,9 @@ func (s *TestSuite) TestGetQueryCPU() {
 	meanIoUsage := 0
 	for i := 0; i < 1000; i++ {
 		query := getQuery(CPU)
-		meanCpuUsage += query.cpuUsage
-		meanMemoryUsage += query.memoryUsage
-		meanIoUsage += query.ioUsage
+		meanCpuUsage += query.usage[ResourceCPU]
+		meanMemoryUsage += query.usage[ResourceMemory]
+		meanIoUsage += query.usage[ResourceIO]
 	}
 	meanCpuUsage /= 1000
 	meanMemoryUsage /= 1000
@@ -24,9 +24,9 @@ func (s *TestSuite) TestGetQueryMemory() {
 	meanIoUsage := 0
 	for i := 0; i < 1000; i++ {
 		query := getQuery(Memory)
-		meanCpuUsage += query.cpuUsage
-		meanMemoryUsage += query.memoryUsage
-		meanIoUsage += query.ioUsage
+		meanCpuUsage += query.usage[ResourceCPU]
+		meanMemoryUsage += query.usage[ResourceMemory]
+		meanIoUsage += query.usage[ResourceIO]
 	}
 	meanCpuUsage /= 1000
 	meanMemoryUsage /= 1000
@@ -42,9 +42,9 @@ func (s *TestSuite) TestGetQueryIO() {
 	meanIoUsage := 0
 	for i := 0; i < 1000; i++ {
 		query := getQuery(IO)
-		meanCpuUsage += query.cpuUsage
-		meanMemoryUsage += query.memoryUsage
-		meanIoUsage += query.ioUsage
+		meanCpuUsage += query.usage[ResourceCPU]
+		meanMemoryUsage += query.usage[ResourceMemory]
+		meanIoUsage += query.usage[ResourceIO]
 	}
 	meanCpuUsage /= 1000
 	meanMemoryUsage /= 1000
@@ -61,9 +61,9 @@ func (s *TestSuite) TestGetQueries() {
 	totalMemoryUsage := 0
 	totalIoUsage := 0
 	for _, query := range queries {
-		totalCpuUsage += query.cpuUsage
-		totalMemoryUsage += query.memoryUsage
-		totalIoUsage += query.ioUsage
+		totalCpuUsage += query.usage[ResourceCPU]
+		totalMemoryUsage += query.usage[ResourceMemory]
+		totalIoUsage += query.usage[ResourceIO]
 	}
 	meanCpuUsage := totalCpuUsage / len(queries)
 	meanMemoryUsage := totalMemoryUsage / len(queries)
@@ -72,3 +72,44 @@ func (s *TestSuite) TestGetQueries() {
 	s.InDelta(meanMemoryUsage, 40, 10)
 	s.InDelta(meanIoUsage, 40, 10)
 }
+
+func (s *TestSuite) TestSeededCatalog() {
+	cfg := DefaultConfig()
+	cfg.Seed = 42
+	cfg.Tenants = []TenantConfig{{Name: "acme", Weight: 1}, {Name: "globex", Weight: 1}}
+	queries, probs, _, err := loadQueries(cfg)
+	s.NoError(err)
+	again, againProbs, _, err := loadQueries(cfg)
+	s.NoError(err)
+	s.Equal(newCatalog(queries, probs), newCatalog(again, againProbs))
+
+	cfg.Seed = 43
+	other, otherProbs, _, err := loadQueries(cfg)
+	s.NoError(err)
+	s.NotEqual(newCatalog(queries, probs), newCatalog(other, otherProbs))
+}
+
+func (s *TestSuite) TestSeededRun() {
+	cfg := DefaultConfig()
+	cfg.Seed = 42
+	cfg.Arrivals.Model = PoissonArrivals
+	cfg.Noise = NoiseConfig{Distribution: NormalNoise, Spread: 0.2}
+	cfg.Durations.Spread = 0.5
+	cfg.Maintenance.Rate = 0.1
+	// arrivals runs a fresh DB for a few ticks and returns every arrival with its drawn usage and duration
+	arrivals := func() []Execution {
+		db, err := NewDBWithConfig(cfg)
+		s.NoError(err)
+		var arrived []Execution
+		for i := 0; i < 50; i++ {
+			queued, _ := db.queue.tick(1)
+			for _, execution := range queued {
+				arrived = append(arrived, Execution{id: execution.id, query: execution.query, kind: execution.kind, usage: execution.usage, duration: execution.duration})
+			}
+		}
+		return arrived
+	}
+	first := arrivals()
+	s.NotEmpty(first)
+	s.Equal(first, arrivals())
+}
@@ -1,16 +1,53 @@
 package lib
 
 import (
+	"errors"
 	"fmt"
+	"sync"
 
 	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrExecutionNotFound = errors.New("execution not found")
+	ErrDelayCeiling      = errors.New("delay exceeds the ceiling for the execution's priority")
+	ErrDeadlineExceeded  = errors.New("delay pushes the execution past its deadline")
+	ErrNegativeDelay     = errors.New("delay must not be negative")
+	ErrHistoryDisabled   = errors.New("execution history is disabled")
 )
 
 type Queue struct {
+	mu           sync.Mutex               // mu guards queued and the state of the executions in it, and is held by the daemon for a whole tick
 	queued       map[uuid.UUID]*Execution // queued is a map of executed queries to their remaining time in the queue in ticks
 	queries      []*Query                 // queries is the list of possible queries
 	probs        *[]float64               // probs is the list of probabilities that a given query is selected
+	catalogMu    sync.RWMutex             // catalogMu guards queries and probs, which churn changes while the catalog may be read
+	churn        *churn                   // churn changes the catalog over the run, if enabled
+	recurring    *recurringSchedule       // recurring adds the runs of recurring jobs to the arrivals, if any
+	maintenance  *maintenance             // maintenance adds background maintenance tasks to the arrivals, if enabled
+	groups       *groupArrivals           // groups adds chains and transactions of executions to the arrivals, if any
+	cluster      *cluster                 // cluster places the arrivals on its nodes, if configured
+	tenantDelay  map[string]int           // tenantDelay is the most ticks each tenant's executions may be held past their default delay
 	defaultDelay int                      // defaultDelay is the default delay of a query in ticks
+	arrivals     ArrivalModel             // arrivals decides which queries arrive on each tick
+	scheduler    Scheduler                // scheduler decides which due executions run on each tick
+	budget       Budget                   // budget caps the resources that may run in a single tick
+	maxDelay     map[Priority]int         // maxDelay is the most ticks the delay API may add per priority, 0 for no ceiling
+	deadlines    DeadlineConfig           // deadlines bounds how long executions may stay queued
+	backpressure BackpressureConfig       // backpressure bounds how many executions may stay queued
+	durations    DurationConfig           // durations controls how long each execution runs for
+	noise        *noise                   // noise draws the usage of each execution around its query's usage
+	cache        *queryCache              // cache reduces the usage of executions whose query's result is cached, if enabled
+	inFlight     Resources                // inFlight is the usage of executions still running from earlier ticks
+	latency      *latencyRecorder         // latency records how long executed queries spent in the queue
+	recorder     *traceRecorder           // recorder writes every arrival to a trace, if recording
+	replay       *traceReplay             // replay supplies the arrivals from a trace instead of the arrival model, if replaying
+	rng          randSource               // rng is the source of every draw made while ticking, only used on the daemon goroutine
+	ticks        int                      // ticks is the number of ticks the queue has processed
+	events       []*Event                 // events holds the events emitted since the last drain
+	history      *historyLog              // history keeps the transitions of recent executions, if enabled
 }
 
 // QueuedOperation represents a query in the queue
@@ -24,8 +61,14 @@ type QueuedQuery struct {
 }
 
 type QueuedExecution struct {
-	ID        string `json:"id"`
-	Timestamp int64  `json:"timestamp"`
+	ID        string        `json:"id"`
+	Timestamp int64         `json:"timestamp"`
+	Priority  Priority      `json:"priority"`
+	Kind      ExecutionKind `json:"kind"`
+	Group     *QueuedGroup  `json:"group,omitempty"` // Group is the chain or transaction the execution belongs to, if any
+	Tenant    string        `json:"tenant"`
+	Write     bool          `json:"write,omitempty"` // Write is set for executions that write, which run on the primary of a cluster
+	Node      string        `json:"node,omitempty"`  // Node is the cluster node the execution is routed to, if a cluster is configured
 }
 
 func newQueue(queries []*Query, probs *[]float64, defaultDelay int) *Queue {
@@ -34,9 +77,25 @@ func newQueue(queries []*Query, probs *[]float64, defaultDelay int) *Queue {
 		queries:      queries,
 		probs:        probs,
 		defaultDelay: defaultDelay,
+		arrivals:     bernoulliModel{rng: processRand{}},
+		scheduler:    fifoScheduler{},
+		maxDelay:     make(map[Priority]int),
+		deadlines:    DeadlineConfig{Policy: DeadlineForceRun},
+		durations:    defaultDurationConfig(),
+		noise:        &noise{cfg: defaultNoiseConfig(), logger: zerolog.Nop()},
+		latency:      newLatencyRecorder(),
+		rng:          processRand{},
 	}
 }
 
+// getCatalog returns the query templates and their arrival probabilities
+func (q *Queue) getCatalog() []CatalogEntry {
+	q.catalogMu.RLock()
+	defer q.catalogMu.RUnlock()
+	return newCatalog(q.queries, q.probs)
+}
+
+// getQueued returns the executions queued. Callers outside the daemon's tick must hold mu.
 func (q *Queue) getQueued() []*Execution {
 	queued := make([]*Execution, 0, len(q.queued))
 	for _, execution := range q.queued {
@@ -46,27 +105,266 @@ func (q *Queue) getQueued() []*Execution {
 }
 
 func (q *Queue) tick(scalar float64) ([]*Execution, []*Execution) {
-	executed := make([]*Execution, 0)
-	for id, execution := range q.queued {
+	q.ticks++
+	for _, execution := range q.queued {
 		execution.delay -= 1
-		if execution.delay <= 0 {
-			executed = append(executed, execution)
+	}
+	// A group member stays queued until its group lets it run, however long ago it became due,
+	// unless waiting another tick for its predecessor in a chain would take it past its deadline
+	due := make([]*Execution, 0)
+	overdue := make([]*Execution, 0)
+	for id, execution := range q.queued {
+		if execution.delay > 0 {
+			continue
+		}
+		if execution.group == nil || execution.group.ready(execution) {
+			due = append(due, execution)
+			delete(q.queued, id)
+			q.transition(execution, StateDue, ActorDefault, "")
+		} else if execution.group.kind == GroupChain && execution.deadline > 0 && q.ticks+1 > execution.deadline {
+			overdue = append(overdue, execution)
 			delete(q.queued, id)
 		}
 	}
 
-	newQueries := selectExecutedQueries(q.probs, q.queries, scalar, q.defaultDelay)
+	// A replayed trace holds the templates churn introduced and the usage of every arrival after a drift
+	if q.churn != nil && q.replay == nil {
+		q.churn.apply(q)
+	}
+
+	var newQueries []*Execution
+	if q.replay != nil {
+		// A trace holds every arrival, including the runs of recurring jobs, maintenance tasks and groups
+		newQueries = q.replay.arrivals(q)
+	} else {
+		newQueries = selectExecutedQueries(q.rng, q.arrivals, q.probs, q.queries, scalar, q.defaultDelay)
+		if q.recurring != nil {
+			newQueries = append(newQueries, q.recurring.arrivals(q.rng, q.ticks, q.defaultDelay)...)
+		}
+		if q.maintenance != nil {
+			newQueries = append(newQueries, q.maintenance.arrivals(q.rng, q.ticks, q.defaultDelay)...)
+		}
+		if q.groups != nil {
+			newQueries = append(newQueries, q.groups.arrivals(q.rng, q.defaultDelay)...)
+		}
+	}
+	for _, query := range newQueries {
+		query.queuedAt = q.ticks
+		query.deadline = q.deadlines.deadlineFor(query)
+		if q.replay != nil {
+			// A replayed execution keeps the duration and usage it was recorded with
+			q.noise.log(query)
+		} else {
+			query.duration = q.durations.draw(q.rng, query.query)
+			q.noise.apply(q.rng, query)
+		}
+		q.transition(query, StateQueued, ActorDefault, "")
+	}
+	if q.cluster != nil {
+		q.cluster.route(newQueries, q.queued)
+	}
+	if q.recorder != nil {
+		if err := q.recorder.record(q.ticks, newQueries); err != nil {
+			log.Err(err).Msg("Stopping trace recording")
+			q.recorder.close()
+			q.recorder = nil
+		}
+	}
+
+	executed, deferred := q.scheduler.Schedule(newQueries, due)
+	scheduled := make(map[*Execution]bool, len(executed))
+	for _, execution := range executed {
+		scheduled[execution] = true
+	}
+	// forced holds the reason of the policy behind each execution run on top of the scheduled ones
+	forced := make(map[*Execution]string)
+	executed, deferred = q.enforce(executed, deferred)
+	executed, carried := q.enforce(q.budget.apply(executed, q.inFlight))
+	for _, execution := range carried {
+		q.emit(EventCarried, execution)
+		forced[execution] = "carried"
+	}
+	deferred = append(deferred, carried...)
+	for _, execution := range deferred {
+		if execution.delay <= 0 {
+			execution.delay = 1
+		}
+		if execution.expired {
+			// A member of a group expired earlier this tick
+			q.emit(EventExpired, execution)
+			q.transition(execution, StateCancelled, ActorPolicy, "group")
+			continue
+		}
+		if execution.groupMisses(q.ticks) {
+			if q.deadlines.Policy == DeadlineExpire {
+				q.emit(EventExpired, execution)
+				q.transition(execution, StateExpired, ActorPolicy, "deadline")
+				q.expireDependents(execution)
+			} else {
+				q.emit(EventForcedRun, execution)
+				forced[execution] = "deadline"
+				executed = append(executed, execution)
+			}
+			continue
+		}
+		q.queued[execution.id] = execution
+		switch {
+		case forced[execution] == "carried":
+			q.transition(execution, StateDelayed, ActorPolicy, "carried")
+		case scheduled[execution]:
+			q.transition(execution, StateDelayed, ActorPolicy, "group")
+		default:
+			q.transition(execution, StateDelayed, ActorScheduler, "deferred")
+		}
+	}
+	// A chain member that would miss its deadline waiting for its predecessor gets the deadline policy
+	for _, execution := range overdue {
+		switch {
+		case execution.expired:
+			q.emit(EventExpired, execution)
+			q.transition(execution, StateCancelled, ActorPolicy, "group")
+		case q.deadlines.Policy == DeadlineExpire:
+			q.emit(EventExpired, execution)
+			q.transition(execution, StateExpired, ActorPolicy, "deadline")
+			q.expireDependents(execution)
+		default:
+			q.emit(EventForcedRun, execution)
+			forced[execution] = "deadline"
+			executed = append(executed, execution)
+		}
+	}
 	for _, query := range newQueries {
 		q.queued[query.id] = query
 	}
+	overflow := q.shed(newQueries)
+	for _, execution := range overflow {
+		forced[execution] = "overflow"
+	}
+	executed = append(executed, overflow...)
+	for _, execution := range executed {
+		switch {
+		case forced[execution] != "" && forced[execution] != "carried":
+			q.transition(execution, StateRunning, ActorPolicy, forced[execution])
+		case scheduled[execution]:
+			q.transition(execution, StateRunning, ActorDefault, "")
+		default:
+			q.transition(execution, StateRunning, ActorPolicy, "enforced")
+		}
+	}
+	arrived := newQueries[:0]
+	for _, query := range newQueries {
+		if !query.expired {
+			arrived = append(arrived, query)
+		}
+	}
+	if q.cache != nil {
+		q.cache.apply(executed, q.ticks)
+	}
+	q.latency.record(executed, q.ticks, q.defaultDelay)
+
+	return arrived, executed
+}
 
-	return newQueries, executed
+func (q *Queue) emit(eventType EventType, execution *Execution) {
+	q.events = append(q.events, newExecutionEvent(eventType, q.ticks, execution))
 }
 
+// drainEvents returns the events emitted since the last call
+func (q *Queue) drainEvents() []*Event {
+	events := q.events
+	q.events = nil
+	return events
+}
+
+// Schedule is the tick an execution is due on before and after a change to it, read under the
+// same lock as the change. A tick is nil when the execution was not queued at that point.
+type Schedule struct {
+	Before *int
+	After  *int
+}
+
+// delay adds to the delay of a queued execution and of its queued dependents, so a chain keeps
+// its order and a transaction stays together. Nothing is delayed unless every one of them can be.
 func (q *Queue) delay(id uuid.UUID, delay int) error {
-	if _, ok := q.queued[id]; !ok {
-		return fmt.Errorf("execution not found")
+	_, err := q.delayWithSchedule(id, delay)
+	return err
+}
+
+// delayWithSchedule applies delay and returns the schedule of the execution around it
+func (q *Queue) delayWithSchedule(id uuid.UUID, delay int) (Schedule, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	schedule := Schedule{Before: q.dueAt(id)}
+	err := q.addDelay(id, delay)
+	schedule.After = q.dueAt(id)
+	return schedule, err
+}
+
+func (q *Queue) addDelay(id uuid.UUID, delay int) error {
+	// A negative delay would run the execution early and give back room under its ceiling
+	if delay < 0 {
+		return ErrNegativeDelay
+	}
+	execution, ok := q.queued[id]
+	if !ok {
+		return ErrExecutionNotFound
+	}
+	delayed := []*Execution{execution}
+	if execution.group != nil {
+		for _, dependent := range execution.group.dependents(execution) {
+			if _, ok := q.queued[dependent.id]; ok {
+				delayed = append(delayed, dependent)
+			}
+		}
+	}
+	for _, execution := range delayed {
+		if ceiling := q.maxDelay[execution.priority]; ceiling > 0 && execution.addedDelay+delay > ceiling {
+			return ErrDelayCeiling
+		}
+		if execution.deadline > 0 && q.ticks+execution.delay+delay > execution.deadline {
+			return ErrDeadlineExceeded
+		}
+		if q.overQuota(execution, execution.delay+delay) {
+			return ErrTenantQuota
+		}
+	}
+	for i, execution := range delayed {
+		execution.delay += delay
+		execution.addedDelay += delay
+		reason := fmt.Sprintf("%d ticks", delay)
+		if i > 0 {
+			reason += " with its group"
+		}
+		q.transition(execution, StateDelayed, ActorDelayAPI, reason)
 	}
-	q.queued[id].delay += delay
 	return nil
 }
+
+// dueAt returns the tick a queued execution is due on, or nil if it is not queued. Callers hold mu.
+func (q *Queue) dueAt(id uuid.UUID) *int {
+	execution, ok := q.queued[id]
+	if !ok {
+		return nil
+	}
+	tick := q.ticks + execution.delay
+	return &tick
+}
+
+// expireDependents expires the queued dependents of an expired execution, which can no longer run in order
+func (q *Queue) expireDependents(execution *Execution) {
+	execution.expired = true
+	if execution.group == nil {
+		return
+	}
+	for _, dependent := range execution.group.dependents(execution) {
+		if dependent.expired {
+			continue
+		}
+		dependent.expired = true
+		if _, ok := q.queued[dependent.id]; ok {
+			delete(q.queued, dependent.id)
+			q.emit(EventExpired, dependent)
+			q.transition(dependent, StateCancelled, ActorPolicy, "group")
+		}
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"os"
 	"sort"
+
+	"github.com/google/uuid"
 )
 
 func (s *TestSuite) TestQueue() {
@@ -59,17 +61,17 @@ func (s *TestSuite) TestQueue() {
 			Tick:      i,
 			NumQueued: len(queued),
 			Executed:  make([]QueryExecution, 0, len(executed)),
-			TotalCPU:  summed.CPU,
-			TotalMem:  summed.Memory,
-			TotalIO:   summed.IO,
+			TotalCPU:  summed.Usage[ResourceCPU],
+			TotalMem:  summed.Usage[ResourceMemory],
+			TotalIO:   summed.Usage[ResourceIO],
 		}
 
 		for _, exec := range executed {
 			tickLog.Executed = append(tickLog.Executed, QueryExecution{
 				QueryID: exec.query.id.String(),
-				CPU:     exec.query.cpuUsage,
-				Memory:  exec.query.memoryUsage,
-				IO:      exec.query.ioUsage,
+				CPU:     exec.query.usage[ResourceCPU],
+				Memory:  exec.query.usage[ResourceMemory],
+				IO:      exec.query.usage[ResourceIO],
 			})
 		}
 
@@ -78,9 +80,9 @@ func (s *TestSuite) TestQueue() {
 		s.InDelta(len(queued), 1, 5) // 0-6 queries queued per tick
 
 		// Record resource usage
-		cpuCounts[summed.CPU]++
-		memoryCounts[summed.Memory]++
-		ioCounts[summed.IO]++
+		cpuCounts[summed.Usage[ResourceCPU]]++
+		memoryCounts[summed.Usage[ResourceMemory]]++
+		ioCounts[summed.Usage[ResourceIO]]++
 	}
 
 	// Save detailed execution log
@@ -140,3 +142,28 @@ func calculateP95(counts map[int]int, totalSamples int) int {
 
 	return 0
 }
+
+func (s *TestSuite) TestDelayWithSchedule() {
+	queue := newQueue(getQueries(1), &[]float64{0}, 1)
+	queue.maxDelay[PriorityLow] = 5
+	execution := newExecution(queue.queries[0], uuid.New(), 3)
+	execution.priority = PriorityLow
+	queue.queued[execution.id] = execution
+	queue.tick(1)
+
+	schedule, err := queue.delayWithSchedule(execution.id, 4)
+	s.NoError(err)
+	s.Equal(3, *schedule.Before)
+	s.Equal(7, *schedule.After)
+
+	// A refused delay leaves the execution due on the same tick
+	schedule, err = queue.delayWithSchedule(execution.id, 2)
+	s.ErrorIs(err, ErrDelayCeiling)
+	s.Equal(7, *schedule.Before)
+	s.Equal(7, *schedule.After)
+
+	schedule, err = queue.delayWithSchedule(uuid.New(), 1)
+	s.ErrorIs(err, ErrExecutionNotFound)
+	s.Nil(schedule.Before)
+	s.Nil(schedule.After)
+}
@@ -0,0 +1,253 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// simulationEpoch is the simulated time of the first tick, which cron schedules are matched against.
+// It is a Monday, so days 6 and 7 are the weekend as they are for the diurnal curve.
+var simulationEpoch = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// RecurringJob is a query that arrives on a schedule rather than at random, such as a report
+// every few minutes or hourly maintenance
+type RecurringJob struct {
+	Name        string     `json:"name"`
+	ID          uuid.UUID  `json:"id"`          // ID is the ID of the job's query template, derived from the name if omitted
+	Every       int        `json:"every"`       // Every is the interval between runs in ticks, when not scheduled by Cron
+	Offset      int        `json:"offset"`      // Offset is the tick of the first run of an interval schedule
+	Cron        string     `json:"cron"`        // Cron is a five-field cron expression matched against the simulated time
+	Usage       Resources  `json:"usage"`       // Usage is the usage of each run, by resource
+	Duration    int        `json:"duration"`    // Duration is the number of ticks each run takes
+	Shape       UsageShape `json:"shape"`       // Shape is how the usage of each run is spread over its duration
+	Priority    Priority   `json:"priority"`    // Priority is the priority of each run, low by default so schedulers may defer it
+	Flexibility int        `json:"flexibility"` // Flexibility is the most ticks a run may be delayed past its default delay
+}
+
+// UnmarshalJSON fills the optional fields of a job with their defaults before decoding
+func (j *RecurringJob) UnmarshalJSON(data []byte) error {
+	type plain RecurringJob
+	decoded := plain{Duration: 1, Shape: FlatShape, Priority: PriorityLow}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*j = RecurringJob(decoded)
+	return nil
+}
+
+func validateRecurringJobs(jobs []RecurringJob) error {
+	seen := make(map[string]bool, len(jobs))
+	for _, job := range jobs {
+		if job.Name == "" || seen[job.Name] {
+			return fmt.Errorf("recurring jobs need a unique name")
+		}
+		seen[job.Name] = true
+		if (job.Every > 0) == (job.Cron != "") {
+			return fmt.Errorf("recurring job %s needs either a positive interval or a cron schedule", job.Name)
+		}
+		if job.Cron != "" {
+			if _, err := parseCron(job.Cron); err != nil {
+				return fmt.Errorf("recurring job %s: %w", job.Name, err)
+			}
+		}
+		if job.Offset < 0 || job.Flexibility < 0 {
+			return fmt.Errorf("recurring job %s must not have a negative offset or flexibility", job.Name)
+		}
+		if job.Duration < 1 {
+			return fmt.Errorf("recurring job %s must have a duration of at least 1 tick", job.Name)
+		}
+		if err := job.Shape.validate(); err != nil {
+			return fmt.Errorf("recurring job %s: %w", job.Name, err)
+		}
+		for name, usage := range job.Usage {
+			if usage < 0 {
+				return fmt.Errorf("recurring job %s must not have a negative %s usage", job.Name, name)
+			}
+		}
+	}
+	return nil
+}
+
+// recurringJob is a job with its query template and parsed schedule
+type recurringJob struct {
+	cfg   RecurringJob
+	query *Query
+	cron  *cronSchedule
+}
+
+// recurringSchedule creates the runs of recurring jobs on the ticks they are due
+type recurringSchedule struct {
+	jobs     []*recurringJob
+	tickrate int
+}
+
+// newRecurringSchedule builds the query template of each job. A run's deadline is its default delay
+// plus the job's flexibility, so the delay API and schedulers may only defer it within that window.
+func newRecurringSchedule(jobs []RecurringJob, tickrate int, defaultDelay int) (*recurringSchedule, error) {
+	s := &recurringSchedule{tickrate: tickrate}
+	for _, cfg := range jobs {
+		id := cfg.ID
+		if id == uuid.Nil {
+			id = uuid.NewSHA1(catalogNamespace, []byte(cfg.Name))
+		}
+		job := &recurringJob{
+			cfg: cfg,
+			query: &Query{
+				id:         id,
+				name:       cfg.Name,
+				profile:    inferProfile(cfg.Usage),
+				duration:   cfg.Duration,
+				shape:      cfg.Shape,
+				usage:      cfg.Usage.clone(),
+				priority:   cfg.Priority,
+				maxLatency: max(1, defaultDelay+cfg.Flexibility),
+				tenant:     DefaultTenant,
+			},
+		}
+		if cfg.Cron != "" {
+			cron, err := parseCron(cfg.Cron)
+			if err != nil {
+				return nil, fmt.Errorf("recurring job %s: %w", cfg.Name, err)
+			}
+			job.cron = cron
+		}
+		s.jobs = append(s.jobs, job)
+	}
+	return s, nil
+}
+
+// queries returns the query templates of the jobs
+func (s *recurringSchedule) queries() []*Query {
+	queries := make([]*Query, len(s.jobs))
+	for i, job := range s.jobs {
+		queries[i] = job.query
+	}
+	return queries
+}
+
+// addTemplates adds the templates of scheduled work to the catalog with a probability of 0, so they
+// only arrive on schedule. A template already in the catalog, such as one exported earlier, is replaced.
+func addTemplates(queries []*Query, probs *[]float64, templates []*Query) []*Query {
+	for _, template := range templates {
+		index := slices.IndexFunc(queries, func(query *Query) bool { return query.id == template.id })
+		if index >= 0 {
+			queries[index] = template
+			continue
+		}
+		queries = append(queries, template)
+		*probs = append(*probs, 0)
+	}
+	return queries
+}
+
+// arrivals returns a new execution of every job due on the given queue tick
+func (s *recurringSchedule) arrivals(rng randSource, tick int, delay int) []*Execution {
+	executions := make([]*Execution, 0)
+	for _, job := range s.jobs {
+		if s.due(job, tick) {
+			executions = append(executions, newExecution(job.query, newRandomID(rng), delay))
+		}
+	}
+	return executions
+}
+
+// due reports whether the job runs on the given queue tick. Queue ticks start at 1, and a cron
+// job runs on the first tick of every simulated minute its schedule matches.
+func (s *recurringSchedule) due(job *recurringJob, tick int) bool {
+	if job.cron == nil {
+		return tick >= job.cfg.Offset && (tick-job.cfg.Offset)%job.cfg.Every == 0
+	}
+	ticksPerMinute := 60 * s.tickrate
+	if (tick-1)%ticksPerMinute != 0 {
+		return false
+	}
+	return job.cron.matches(simulationEpoch.Add(time.Duration(tick-1) * time.Second / time.Duration(s.tickrate)))
+}
+
+// cronSchedule holds the values each field of a cron expression matches: minute, hour,
+// day of month, month and day of week, with Sunday as 0 or 7
+type cronSchedule struct {
+	fields [5]map[int]bool
+	any    [5]bool // any is set for fields starting with *, such as * or */2, which cron treats as unrestricted days
+}
+
+var cronRanges = [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+
+// parseCron parses a five-field cron expression. Each field is a comma-separated list of *, n,
+// a-b, */step or a-b/step.
+func parseCron(expr string) (*cronSchedule, error) {
+	parts := strings.Fields(expr)
+	if len(parts) != 5 {
+		return nil, fmt.Errorf("cron expression %q must have 5 fields", expr)
+	}
+	schedule := &cronSchedule{}
+	for i, part := range parts {
+		schedule.any[i] = strings.HasPrefix(part, "*")
+		schedule.fields[i] = make(map[int]bool)
+		for _, item := range strings.Split(part, ",") {
+			if err := schedule.parseItem(i, item); err != nil {
+				return nil, fmt.Errorf("cron expression %q: %w", expr, err)
+			}
+		}
+	}
+	if schedule.fields[4][7] {
+		schedule.fields[4][0] = true
+	}
+	return schedule, nil
+}
+
+func (c *cronSchedule) parseItem(field int, item string) error {
+	lo, hi := cronRanges[field][0], cronRanges[field][1]
+	rangePart, stepPart, hasStep := strings.Cut(item, "/")
+	step := 1
+	if hasStep {
+		var err error
+		if step, err = strconv.Atoi(stepPart); err != nil || step < 1 {
+			return fmt.Errorf("invalid step %q", stepPart)
+		}
+	}
+
+	start, end := lo, hi
+	if rangePart != "*" {
+		first, last, isRange := strings.Cut(rangePart, "-")
+		var err error
+		if start, err = strconv.Atoi(first); err != nil {
+			return fmt.Errorf("invalid value %q", first)
+		}
+		end = start
+		if isRange {
+			if end, err = strconv.Atoi(last); err != nil {
+				return fmt.Errorf("invalid value %q", last)
+			}
+		} else if hasStep {
+			end = hi
+		}
+	}
+	if start < lo || end > hi || start > end {
+		return fmt.Errorf("%q is out of range %d-%d", item, lo, hi)
+	}
+	for value := start; value <= end; value += step {
+		c.fields[field][value] = true
+	}
+	return nil
+}
+
+// matches reports whether the schedule matches the minute of t. As in cron, when both the day of
+// month and the day of week are restricted, a day matching either is enough.
+func (c *cronSchedule) matches(t time.Time) bool {
+	if !c.fields[0][t.Minute()] || !c.fields[1][t.Hour()] || !c.fields[3][int(t.Month())] {
+		return false
+	}
+	dayOfMonth := c.fields[2][t.Day()]
+	dayOfWeek := c.fields[4][int(t.Weekday())]
+	if c.any[2] || c.any[4] {
+		return dayOfMonth && dayOfWeek
+	}
+	return dayOfMonth || dayOfWeek
+}
@@ -0,0 +1,115 @@
+package lib
+
+import (
+	"encoding/json"
+	"time"
+)
+
+func (s *TestSuite) TestRecurringIntervalArrivals() {
+	probs := []float64{0}
+	queue := newQueue(getQueries(1), &probs, 1)
+	recurring, err := newRecurringSchedule([]RecurringJob{
+		{Name: "report", Every: 5, Offset: 2, Usage: Resources{ResourceCPU: 500}, Duration: 1, Shape: FlatShape},
+	}, 10, 1)
+	s.Require().NoError(err)
+	queue.queries = addTemplates(queue.queries, queue.probs, recurring.queries())
+	queue.recurring = recurring
+	s.Len(queue.queries, 2)
+	s.Equal(0.0, probs[1])
+
+	arrivedOn := make([]int, 0)
+	for tick := 1; tick <= 12; tick++ {
+		arrived, _ := queue.tick(1)
+		for _, execution := range arrived {
+			s.Equal("report", execution.query.name)
+			s.Equal(500, execution.usage[ResourceCPU])
+			arrivedOn = append(arrivedOn, tick)
+		}
+	}
+	s.Equal([]int{2, 7, 12}, arrivedOn)
+}
+
+func (s *TestSuite) TestRecurringFlexibility() {
+	probs := []float64{0}
+	queue := newQueue(getQueries(1), &probs, 1)
+	recurring, err := newRecurringSchedule([]RecurringJob{
+		{Name: "vacuum", Every: 100, Offset: 1, Usage: Resources{ResourceIO: 800}, Duration: 1, Shape: FlatShape, Flexibility: 3},
+	}, 10, 1)
+	s.Require().NoError(err)
+	queue.queries = addTemplates(queue.queries, queue.probs, recurring.queries())
+	queue.recurring = recurring
+
+	arrived, _ := queue.tick(1)
+	s.Require().Len(arrived, 1)
+	s.Equal(IO, arrived[0].query.profile)
+	s.NoError(queue.delay(arrived[0].id, 3))
+	s.ErrorIs(queue.delay(arrived[0].id, 1), ErrDeadlineExceeded)
+}
+
+func (s *TestSuite) TestCronMatches() {
+	schedule, err := parseCron("*/15 9-17 * * 1-5")
+	s.Require().NoError(err)
+	s.True(schedule.matches(time.Date(2024, 1, 1, 9, 30, 0, 0, time.UTC)))
+	s.False(schedule.matches(time.Date(2024, 1, 1, 9, 31, 0, 0, time.UTC)))
+	s.False(schedule.matches(time.Date(2024, 1, 1, 18, 0, 0, 0, time.UTC)))
+	s.False(schedule.matches(time.Date(2024, 1, 6, 9, 30, 0, 0, time.UTC)))
+
+	// Both days restricted, so either matching is enough
+	schedule, err = parseCron("0 0 1 * 7")
+	s.Require().NoError(err)
+	s.True(schedule.matches(time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)))
+	s.True(schedule.matches(time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC)))
+	s.False(schedule.matches(time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC)))
+
+	// A stepped * still counts as unrestricted, so both days must match
+	schedule, err = parseCron("0 0 */2 * 1")
+	s.Require().NoError(err)
+	s.True(schedule.matches(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)))
+	s.False(schedule.matches(time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)))
+	s.False(schedule.matches(time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC)))
+
+	for _, expr := range []string{"* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		_, err := parseCron(expr)
+		s.Error(err, expr)
+	}
+}
+
+func (s *TestSuite) TestRecurringCronArrivals() {
+	recurring, err := newRecurringSchedule([]RecurringJob{{Name: "hourly", Cron: "2 * * * *"}}, 1, 1)
+	s.Require().NoError(err)
+	// At 1 tick per second, minute 2 starts on tick 121 and the next hour's on tick 3721
+	due := make([]int, 0)
+	for tick := 1; tick <= 4000; tick++ {
+		if len(recurring.arrivals(processRand{}, tick, 1)) > 0 {
+			due = append(due, tick)
+		}
+	}
+	s.Equal([]int{121, 3721}, due)
+}
+
+func (s *TestSuite) TestRecurringConfig() {
+	var job RecurringJob
+	s.Require().NoError(json.Unmarshal([]byte(`{"name": "backup", "every": 10}`), &job))
+	s.Equal(1, job.Duration)
+	s.Equal(FlatShape, job.Shape)
+	s.Equal(PriorityLow, job.Priority)
+	s.NoError(validateRecurringJobs([]RecurringJob{job}))
+
+	invalid := [][]RecurringJob{
+		{job, job},
+		{{Name: "none", Duration: 1, Shape: FlatShape}},
+		{{Name: "both", Every: 1, Cron: "* * * * *", Duration: 1, Shape: FlatShape}},
+		{{Name: "cron", Cron: "* * *", Duration: 1, Shape: FlatShape}},
+		{{Name: "flex", Every: 1, Flexibility: -1, Duration: 1, Shape: FlatShape}},
+		{{Name: "usage", Every: 1, Usage: Resources{ResourceCPU: -1}, Duration: 1, Shape: FlatShape}},
+	}
+	for _, jobs := range invalid {
+		s.Error(validateRecurringJobs(jobs), jobs[0].Name)
+	}
+
+	// A replayed trace holds the runs, so the jobs may stay configured
+	cfg := DefaultConfig()
+	cfg.Recurring = []RecurringJob{job}
+	cfg.Trace.Replay = "trace.json"
+	s.NoError(cfg.validate())
+}
@@ -0,0 +1,199 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	ResourceCPU    = "cpu"
+	ResourceMemory = "memory"
+	ResourceIO     = "io"
+)
+
+// builtinResources are the resources every query uses, generated from its profile
+var builtinResources = []string{ResourceCPU, ResourceMemory, ResourceIO}
+
+// reservedResourceNames would collide with the other fields of the JSON APIs resources are flattened into
+var reservedResourceNames = []string{"running", "throttled", "depth", "queue", "cache", "tenants", "tenant", "write", "timestamp"}
+
+// Resources is a usage vector keyed by resource name. A resource that is missing uses 0.
+type Resources map[string]int
+
+// ResourceSemantics is how a resource is used over the ticks an execution runs for
+type ResourceSemantics string
+
+const (
+	InstantResource    ResourceSemantics = "instant"    // used on each tick of work, following the usage shape and slowed by saturation, like CPU
+	HeldResource       ResourceSemantics = "held"       // held in full from when an execution starts until it completes, even while throttled, like memory
+	ThroughputResource ResourceSemantics = "throughput" // a volume moved at the usage rate, reported with the total moved per metrics interval, like IO
+)
+
+// SemanticsConfig maps resources to their semantics. Resources that are missing are instant.
+type SemanticsConfig map[string]ResourceSemantics
+
+func defaultSemanticsConfig() SemanticsConfig {
+	return SemanticsConfig{
+		ResourceCPU:    InstantResource,
+		ResourceMemory: HeldResource,
+		ResourceIO:     ThroughputResource,
+	}
+}
+
+func (c SemanticsConfig) validate() error {
+	for name, semantics := range c {
+		switch semantics {
+		case InstantResource, HeldResource, ThroughputResource:
+		default:
+			return fmt.Errorf("unknown semantics %q for resource %s", semantics, name)
+		}
+	}
+	return nil
+}
+
+// of returns the semantics of the resource
+func (c SemanticsConfig) of(name string) ResourceSemantics {
+	if semantics, ok := c[name]; ok {
+		return semantics
+	}
+	return InstantResource
+}
+
+// ResourceConfig describes a resource beyond CPU, memory and IO, such as network egress or connection slots
+type ResourceConfig struct {
+	Name   string  `json:"name"`
+	Mean   float64 `json:"mean"`   // Mean is the mean usage of a generated query
+	Spread float64 `json:"spread"` // Spread is the standard deviation of the usage of generated queries
+	Skew   float64 `json:"skew"`   // Skew is the skewness of the usage of generated queries, positive for a long tail
+}
+
+func validateResources(resources []ResourceConfig) error {
+	seen := make(map[string]bool, len(resources))
+	for _, resource := range resources {
+		if resource.Name == "" {
+			return fmt.Errorf("resources need a name")
+		}
+		if slices.Contains(builtinResources, resource.Name) || slices.Contains(reservedResourceNames, resource.Name) || seen[resource.Name] {
+			return fmt.Errorf("resource name %q is reserved or duplicated", resource.Name)
+		}
+		if resource.Mean < 0 || resource.Spread < 0 {
+			return fmt.Errorf("resource %s must not have a negative mean or spread", resource.Name)
+		}
+		seen[resource.Name] = true
+	}
+	return nil
+}
+
+// resourceDimensions lists the built-in resources, then the configured ones in order, then any other
+// resource a query uses, sorted
+func resourceDimensions(resources []ResourceConfig, queries []*Query) []string {
+	dimensions := slices.Clone(builtinResources)
+	for _, resource := range resources {
+		dimensions = append(dimensions, resource.Name)
+	}
+	extra := make([]string, 0)
+	for _, query := range queries {
+		for name := range query.usage {
+			if !slices.Contains(dimensions, name) && !slices.Contains(extra, name) {
+				extra = append(extra, name)
+			}
+		}
+	}
+	sort.Strings(extra)
+	return append(dimensions, extra...)
+}
+
+// assignResources draws the usage of the configured resources for generated queries
+func assignResources(queries []*Query, resources []ResourceConfig, rng randSource) {
+	for _, query := range queries {
+		for _, resource := range resources {
+			query.usage[resource.Name] = max(0, int(skewNorm(rng, resource.Mean, resource.Spread, resource.Skew)))
+		}
+	}
+}
+
+func (r Resources) clone() Resources {
+	clone := make(Resources, len(r))
+	for name, usage := range r {
+		clone[name] = usage
+	}
+	return clone
+}
+
+// add adds the usage of other, scaled by factor, to r
+func (r Resources) add(other Resources, factor float64) {
+	for name, usage := range other {
+		r[name] += int(math.Round(float64(usage) * factor))
+	}
+}
+
+// names lists the resources used, with the built-in resources first and the others sorted
+func (r Resources) names() []string {
+	return resourceNames(r)
+}
+
+func (r Resources) MarshalZerologObject(event *zerolog.Event) {
+	for _, name := range r.names() {
+		event.Int(name, r[name])
+	}
+}
+
+// resourceNames lists the resources used by any of the maps, with the built-in resources first and the others sorted
+func resourceNames[M ~map[string]T, T any](maps ...M) []string {
+	names := make([]string, 0)
+	for _, m := range maps {
+		for name := range m {
+			if !slices.Contains(builtinResources, name) && !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	builtin := make([]string, 0, len(builtinResources))
+	for _, name := range builtinResources {
+		for _, m := range maps {
+			if _, ok := m[name]; ok {
+				builtin = append(builtin, name)
+				break
+			}
+		}
+	}
+	return append(builtin, names...)
+}
+
+// marshalFlattened marshals v with each resource written as a top-level key ahead of v's own fields,
+// so resources appear alongside the other fields of the JSON APIs as cpu, memory and io always have
+func marshalFlattened[T any](resources map[string]T, names []string, v any) ([]byte, error) {
+	fields, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for _, name := range names {
+		key, _ := json.Marshal(name)
+		value, err := json.Marshal(resources[name])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+		buf.WriteByte(',')
+	}
+	if len(fields) > 2 {
+		buf.Write(fields[1:])
+		return buf.Bytes(), nil
+	}
+	if len(names) > 0 {
+		buf.Truncate(buf.Len() - 1)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
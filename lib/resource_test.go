@@ -0,0 +1,72 @@
+package lib
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+func (s *TestSuite) TestValidateResources() {
+	s.NoError(validateResources([]ResourceConfig{{Name: "network", Mean: 20, Spread: 5}, {Name: "connections", Mean: 1}}))
+	s.Error(validateResources([]ResourceConfig{{Name: ""}}))
+	s.Error(validateResources([]ResourceConfig{{Name: ResourceCPU}}))
+	s.Error(validateResources([]ResourceConfig{{Name: "running"}}))
+	s.Error(validateResources([]ResourceConfig{{Name: "network"}, {Name: "network"}}))
+	s.Error(validateResources([]ResourceConfig{{Name: "network", Mean: -1}}))
+}
+
+func (s *TestSuite) TestAssignResources() {
+	queries := getQueries(1000)
+	assignResources(queries, []ResourceConfig{{Name: "connections", Mean: 2}}, processRand{})
+	for _, query := range queries {
+		s.Equal(2, query.usage["connections"])
+		s.Contains(query.usage, ResourceCPU)
+	}
+
+	s.Equal([]string{ResourceCPU, ResourceMemory, ResourceIO, "connections", "locks"},
+		resourceDimensions([]ResourceConfig{{Name: "connections"}}, []*Query{{usage: Resources{"locks": 1}}}))
+}
+
+func (s *TestSuite) TestResourceNames() {
+	s.Equal([]string{ResourceCPU, ResourceIO, "locks", "network"}, Resources{"network": 1, ResourceIO: 1, "locks": 1, ResourceCPU: 1}.names())
+	s.Empty(Resources{}.names())
+}
+
+func (s *TestSuite) TestMonitorTracksDimensions() {
+	monitor := newMonitor(time.Second, 10, []string{ResourceCPU, ResourceMemory, ResourceIO, "network"})
+	monitor.update(Resources{ResourceCPU: 10, "network": 4})
+	monitor.update(Resources{ResourceCPU: 30, "network": 8, "locks": 2})
+	monitor.aggregate()
+
+	metrics := monitor.getResources()
+	s.Equal([]string{ResourceCPU, ResourceMemory, ResourceIO, "network", "locks"}, metrics.Dimensions())
+	s.Equal(ResourceUsage{Average: 20, Min: 10, Max: 30}, metrics.Resources[ResourceCPU])
+	s.Equal(ResourceUsage{}, metrics.Resources[ResourceMemory])
+	s.Equal(ResourceUsage{Average: 6, Min: 4, Max: 8}, metrics.Resources["network"])
+	s.Equal(ResourceUsage{Average: 2, Min: 2, Max: 2}, metrics.Resources["locks"])
+
+	data, err := json.Marshal(metrics)
+	s.NoError(err)
+	s.True(strings.HasPrefix(string(data), `{"cpu":{"average":20,"min":10,"max":30},"memory":`))
+	var decoded map[string]any
+	s.NoError(json.Unmarshal(data, &decoded))
+	s.Contains(decoded, "network")
+	s.Contains(decoded, "running")
+	s.Contains(decoded, "timestamp")
+
+	var roundTrip ResourceMetrics
+	s.NoError(json.Unmarshal(data, &roundTrip))
+	s.Equal(*metrics, roundTrip)
+}
+
+func (s *TestSuite) TestMonitorThroughputTotal() {
+	monitor := newMonitor(time.Second, 10, []string{ResourceCPU, ResourceIO})
+	monitor.semantics = defaultSemanticsConfig()
+	monitor.update(Resources{ResourceCPU: 10, ResourceIO: 30})
+	monitor.update(Resources{ResourceCPU: 20, ResourceIO: 50})
+	monitor.aggregate()
+
+	metrics := monitor.getResources()
+	s.Equal(ResourceUsage{Average: 15, Min: 10, Max: 20}, metrics.Resources[ResourceCPU])
+	s.Equal(ResourceUsage{Average: 40, Min: 30, Max: 50, Total: 80}, metrics.Resources[ResourceIO])
+}
@@ -1,14 +1,67 @@
 package lib
 
 import (
+	"io"
 	"math"
 	"math/rand"
+
+	"github.com/google/uuid"
 )
 
+// randSource is where random draws come from. With Config.Seed set, generating the catalog draws
+// from a source seeded by it and each DB's queue from a second one, so that the same seed generates
+// the same catalog and the same arrivals, durations, noise, maintenance tasks, groups and churn.
+// Without a seed, both draw from the process-wide source.
+type randSource interface {
+	Float64() float64
+	NormFloat64() float64
+	ExpFloat64() float64
+	Intn(n int) int
+}
+
+// processRand draws from the process-wide source, which is safe for concurrent use
+type processRand struct{}
+
+func (processRand) Float64() float64     { return rand.Float64() }
+func (processRand) NormFloat64() float64 { return rand.NormFloat64() }
+func (processRand) ExpFloat64() float64  { return rand.ExpFloat64() }
+func (processRand) Intn(n int) int       { return rand.Intn(n) }
+
+// newRandSource returns a source seeded with seed, or the process-wide source for a seed of 0
+func newRandSource(seed int64) randSource {
+	if seed == 0 {
+		return processRand{}
+	}
+	return rand.New(rand.NewSource(seed))
+}
+
+// newRuntimeSource returns the source a queue draws from while running, or the process-wide source
+// for a seed of 0. It is seeded from seed on a stream of its own, so it does not repeat the draws that
+// generated the catalog. A seeded source is not safe for concurrent use: it is only used on the
+// daemon goroutine.
+func newRuntimeSource(seed int64) randSource {
+	if seed == 0 {
+		return processRand{}
+	}
+	return rand.New(rand.NewSource(rand.New(rand.NewSource(seed)).Int63()))
+}
+
+// newRandomID returns a random UUID, drawn from the source when it is seeded
+func newRandomID(rng randSource) uuid.UUID {
+	if reader, ok := rng.(io.Reader); ok {
+		return uuid.Must(uuid.NewRandomFromReader(reader))
+	}
+	return uuid.New()
+}
+
 func SkewNorm(mu, sigma, lambda float64) float64 {
+	return skewNorm(processRand{}, mu, sigma, lambda)
+}
+
+func skewNorm(rng randSource, mu, sigma, lambda float64) float64 {
 	delta := lambda / math.Sqrt(1+lambda*lambda)
-	U := rand.NormFloat64()
-	V := rand.NormFloat64()
+	U := rng.NormFloat64()
+	V := rng.NormFloat64()
 	X := U*math.Sqrt(1-delta*delta) + delta*math.Abs(V)
 	return mu + sigma*X
 }
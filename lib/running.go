@@ -0,0 +1,210 @@
+package lib
+
+import (
+	"fmt"
+	"math"
+)
+
+// UsageShape is how an execution's usage is spread over the ticks it runs for
+type UsageShape string
+
+const (
+	FlatShape      UsageShape = "flat"      // full usage on every tick
+	RampUpShape    UsageShape = "ramp_up"   // usage grows linearly to full on the last tick
+	RampDownShape  UsageShape = "ramp_down" // full usage on the first tick, falling linearly
+	TrapezoidShape UsageShape = "trapezoid" // ramps up over the first quarter and down over the last quarter
+)
+
+// DurationConfig controls how long executions run for
+type DurationConfig struct {
+	Mean   int        `json:"mean"`   // Mean is the mean duration in ticks of generated queries, 1 to complete in the tick they run
+	Spread float64    `json:"spread"` // Spread is the standard deviation of an execution's duration, relative to its query's duration
+	Skew   float64    `json:"skew"`   // Skew is the skewness of the duration distribution, positive for a long tail
+	Shape  UsageShape `json:"shape"`  // Shape is the usage shape of generated queries
+}
+
+func defaultDurationConfig() DurationConfig {
+	return DurationConfig{
+		Mean:  1,
+		Shape: FlatShape,
+	}
+}
+
+func (c DurationConfig) validate() error {
+	if c.Mean < 1 {
+		return fmt.Errorf("duration mean must be at least 1 tick")
+	}
+	if c.Spread < 0 {
+		return fmt.Errorf("duration spread must not be negative")
+	}
+	return c.Shape.validate()
+}
+
+func (s UsageShape) validate() error {
+	switch s {
+	case FlatShape, RampUpShape, RampDownShape, TrapezoidShape:
+		return nil
+	}
+	return fmt.Errorf("unknown usage shape %q", s)
+}
+
+// factor is the share of the full usage an execution of the given duration uses on its tick elapsed
+func (s UsageShape) factor(elapsed int, duration int) float64 {
+	switch s {
+	case RampUpShape:
+		return float64(elapsed+1) / float64(duration)
+	case RampDownShape:
+		return float64(duration-elapsed) / float64(duration)
+	case TrapezoidShape:
+		ramp := float64((duration + 3) / 4)
+		return math.Min(1, math.Min(float64(elapsed+1)/ramp, float64(duration-elapsed)/ramp))
+	default:
+		return 1
+	}
+}
+
+// assignDurations gives generated queries a mean duration, exponentially distributed around the configured mean
+func assignDurations(queries []*Query, cfg DurationConfig, rng randSource) {
+	for _, query := range queries {
+		query.shape = cfg.Shape
+		if cfg.Mean > 1 {
+			query.duration = max(1, int(math.Round(rng.ExpFloat64()*float64(cfg.Mean))))
+		}
+	}
+}
+
+// draw returns the number of ticks an execution of the query runs for
+func (c DurationConfig) draw(rng randSource, query *Query) int {
+	if c.Spread == 0 || query.duration == 1 {
+		return query.duration
+	}
+	mean := float64(query.duration)
+	return max(1, int(math.Round(skewNorm(rng, mean, mean*c.Spread, c.Skew))))
+}
+
+// runningExecution is an execution that has started and has not completed yet
+type runningExecution struct {
+	execution *Execution
+	elapsed   int     // elapsed is the number of ticks the execution has run for
+	progress  float64 // progress is the number of ticks of work done, which falls behind elapsed when saturated
+}
+
+// step is the tick of work the execution is on, which decides its share of the usage shape
+func (r *runningExecution) step() int {
+	return min(int(r.progress), r.execution.duration-1)
+}
+
+// runSet holds the executions in flight, which use resources on every tick until they complete
+type runSet struct {
+	running   []*runningExecution
+	capacity  CapacityConfig   // capacity slows executions down when their demand exceeds it
+	semantics SemanticsConfig  // semantics decides how each resource is used over the ticks an execution runs for
+	latency   *latencyRecorder // latency records how far saturation stretched completed executions, if set
+	throttler Throttler        // throttler paces the maintenance tasks in flight, if the scheduler implements it
+	now       int              // now is the queue tick being run, which the slack of maintenance tasks is counted from
+	tenants   bool             // tenants splits the usage of each tick by tenant
+	history   *historyLog      // history records the executions completing, if enabled
+}
+
+func newRunSet() *runSet {
+	return &runSet{running: make([]*runningExecution, 0)}
+}
+
+// start adds executions that were run this tick
+func (r *runSet) start(executions []*Execution) {
+	for _, execution := range executions {
+		if execution.duration < 1 {
+			execution.duration = 1
+		}
+		r.running = append(r.running, &runningExecution{execution: execution})
+	}
+}
+
+// tick advances every execution in flight by the work the capacity and the throttler allow this
+// tick, sums the usage of that work and removes the executions that have completed. A throttled
+// maintenance task needs only its rate of the resources that are not held.
+func (r *runSet) tick() ResourceUpdate {
+	rates := r.throttle()
+	demands := make([]Resources, len(r.running))
+	profiles := make([]Profile, len(r.running))
+	for i, run := range r.running {
+		demands[i] = run.demand(r.semantics)
+		profiles[i] = run.execution.query.profile
+		if rates[i] < 1 {
+			for name, demand := range demands[i] {
+				if r.semantics.of(name) != HeldResource {
+					demands[i][name] = int(math.Round(float64(demand) * rates[i]))
+				}
+			}
+		}
+	}
+	saturation := r.capacity.progress(demands, profiles)
+
+	update := ResourceUpdate{Usage: make(Resources), Running: len(r.running)}
+	if r.tenants {
+		update.Tenants = make(map[string]Resources)
+	}
+	running := r.running[:0]
+	for i, run := range r.running {
+		used := make(Resources, len(demands[i]))
+		for name, demand := range demands[i] {
+			if r.semantics.of(name) == HeldResource {
+				used[name] = demand
+			} else {
+				used[name] = int(math.Round(float64(demand) * saturation[i]))
+			}
+		}
+		update.Usage.add(used, 1)
+		if r.tenants {
+			tenant := run.execution.tenant
+			if update.Tenants[tenant] == nil {
+				update.Tenants[tenant] = make(Resources)
+			}
+			update.Tenants[tenant].add(used, 1)
+		}
+		progress := saturation[i] * rates[i]
+		if progress < 1 {
+			update.Throttled++
+		}
+		run.elapsed++
+		run.progress += progress
+		if run.progress < float64(run.execution.duration)-1e-9 {
+			running = append(running, run)
+			continue
+		}
+		run.execution.completed = true
+		if r.history != nil {
+			r.history.record(run.execution, StateCompleted, ActorDefault, "", r.now)
+		}
+		if r.latency != nil && run.execution.kind != KindMaintenance {
+			r.latency.recordStretch(run.execution, run.elapsed-run.execution.duration)
+		}
+	}
+	r.running = running
+	return update
+}
+
+// usage sums the demand of the executions in flight for the current tick
+func (r *runSet) usage() Resources {
+	usage := make(Resources)
+	for _, run := range r.running {
+		usage.add(run.demand(r.semantics), 1)
+	}
+	return usage
+}
+
+// demand is the usage the execution needs for its current tick of work. Held resources are
+// needed in full for the whole run, the others follow the usage shape.
+func (r *runningExecution) demand(semantics SemanticsConfig) Resources {
+	execution := r.execution
+	factor := execution.query.shape.factor(r.step(), execution.duration)
+	demand := make(Resources, len(execution.usage))
+	for name, usage := range execution.usage {
+		if semantics.of(name) == HeldResource {
+			demand[name] = usage
+		} else {
+			demand[name] = int(math.Round(float64(usage) * factor))
+		}
+	}
+	return demand
+}
@@ -0,0 +1,104 @@
+package lib
+
+func (s *TestSuite) TestUsageShapes() {
+	tests := []struct {
+		shape    UsageShape
+		expected []float64
+	}{
+		{FlatShape, []float64{1, 1, 1, 1, 1, 1, 1, 1}},
+		{RampUpShape, []float64{0.125, 0.25, 0.375, 0.5, 0.625, 0.75, 0.875, 1}},
+		{RampDownShape, []float64{1, 0.875, 0.75, 0.625, 0.5, 0.375, 0.25, 0.125}},
+		{TrapezoidShape, []float64{0.5, 1, 1, 1, 1, 1, 1, 0.5}},
+	}
+	for _, test := range tests {
+		for elapsed, expected := range test.expected {
+			s.InDelta(expected, test.shape.factor(elapsed, len(test.expected)), 1e-9, string(test.shape))
+		}
+		s.Equal(1.0, test.shape.factor(0, 1), string(test.shape))
+	}
+}
+
+func (s *TestSuite) TestRunSetOverlapsExecutions() {
+	long := &Query{shape: FlatShape}
+	short := &Query{shape: FlatShape}
+	running := newRunSet()
+
+	running.start([]*Execution{{query: long, duration: 3, usage: Resources{ResourceCPU: 10, ResourceMemory: 20, ResourceIO: 30}}})
+	s.Equal(ResourceUpdate{Usage: Resources{ResourceCPU: 10, ResourceMemory: 20, ResourceIO: 30}, Running: 1}, running.tick())
+
+	running.start([]*Execution{{query: short, usage: Resources{ResourceCPU: 1, ResourceMemory: 1, ResourceIO: 1, "network": 5}}})
+	s.Equal(ResourceUpdate{Usage: Resources{ResourceCPU: 11, ResourceMemory: 21, ResourceIO: 31, "network": 5}, Running: 2}, running.tick())
+	s.Equal(Resources{ResourceCPU: 10, ResourceMemory: 20, ResourceIO: 30}, running.usage())
+	s.Equal(ResourceUpdate{Usage: Resources{ResourceCPU: 10, ResourceMemory: 20, ResourceIO: 30}, Running: 1}, running.tick())
+	s.Equal(ResourceUpdate{Usage: Resources{}}, running.tick())
+}
+
+func (s *TestSuite) TestDurationDraw() {
+	query := &Query{duration: 10}
+	s.Equal(10, DurationConfig{}.draw(processRand{}, query))
+
+	cfg := DurationConfig{Spread: 0.5, Skew: 4}
+	total := 0
+	for i := 0; i < 10000; i++ {
+		duration := cfg.draw(processRand{}, query)
+		s.GreaterOrEqual(duration, 1)
+		total += duration
+	}
+	s.Greater(float64(total)/10000, 10.0)
+	s.Equal(1, cfg.draw(processRand{}, &Query{duration: 1}))
+}
+
+func (s *TestSuite) TestDurationConfigValidation() {
+	s.NoError(defaultDurationConfig().validate())
+	s.Error(DurationConfig{Mean: 0, Shape: FlatShape}.validate())
+
+	cfg := DefaultConfig()
+	cfg.Durations.Spread = 0.5
+	s.NoError(cfg.validate())
+	cfg.Trace.Record = "trace.ndjson"
+	s.NoError(cfg.validate())
+}
+
+func (s *TestSuite) TestAssignDurations() {
+	queries := getQueries(1000)
+	assignDurations(queries, DurationConfig{Mean: 1, Shape: RampUpShape}, processRand{})
+	for _, query := range queries {
+		s.Equal(1, query.duration)
+		s.Equal(RampUpShape, query.shape)
+	}
+
+	assignDurations(queries, DurationConfig{Mean: 10, Shape: FlatShape}, processRand{})
+	total := 0
+	for _, query := range queries {
+		s.GreaterOrEqual(query.duration, 1)
+		total += query.duration
+	}
+	s.InDelta(10, float64(total)/1000, 1.5)
+}
+
+func (s *TestSuite) TestRunSetResourceSemantics() {
+	query := &Query{shape: RampUpShape, profile: Memory}
+	running := newRunSet()
+	running.semantics = defaultSemanticsConfig()
+	running.capacity = CapacityConfig{Limits: Resources{ResourceCPU: 50}}
+
+	running.start([]*Execution{{query: query, duration: 2, usage: Resources{ResourceCPU: 100, ResourceMemory: 80, ResourceIO: 40}}})
+
+	// The CPU and IO ramp up, while the memory is held in full from the first tick
+	update := running.tick()
+	s.Equal(Resources{ResourceCPU: 50, ResourceMemory: 80, ResourceIO: 20}, update.Usage)
+	s.Equal(Resources{ResourceCPU: 100, ResourceMemory: 80, ResourceIO: 40}, running.usage())
+
+	// Saturation stretches the run, and the memory stays held until it completes
+	for len(running.running) > 0 {
+		update = running.tick()
+		s.Equal(80, update.Usage[ResourceMemory])
+	}
+}
+
+func (s *TestSuite) TestSemanticsConfig() {
+	s.NoError(defaultSemanticsConfig().validate())
+	s.Error(SemanticsConfig{"network": "pooled"}.validate())
+	s.Equal(InstantResource, defaultSemanticsConfig().of("network"))
+	s.Equal(HeldResource, defaultSemanticsConfig().of(ResourceMemory))
+}
@@ -0,0 +1,58 @@
+package lib
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Scheduler decides, on every tick, which of the due executions run now and which are deferred.
+// arrived holds the executions queued during the tick, so a policy can anticipate upcoming load.
+// Deferred executions are returned to the queue and reconsidered on the next tick, unless the
+// scheduler has pushed their delay out further.
+type Scheduler interface {
+	Schedule(arrived []*Execution, due []*Execution) (run []*Execution, deferred []*Execution)
+}
+
+// FIFOScheduler is the name of the default scheduler
+const FIFOScheduler = "fifo"
+
+var (
+	schedulersMu sync.RWMutex // schedulersMu guards schedulers, so a scheduler can be registered while databases are created
+	schedulers   = map[string]func() Scheduler{
+		FIFOScheduler: func() Scheduler { return fifoScheduler{} },
+	}
+)
+
+// RegisterScheduler makes a scheduler selectable by name through Config.Scheduler. It is safe to
+// call concurrently with creating databases.
+func RegisterScheduler(name string, factory func() Scheduler) {
+	schedulersMu.Lock()
+	defer schedulersMu.Unlock()
+	schedulers[name] = factory
+}
+
+func newScheduler(name string) (Scheduler, error) {
+	schedulersMu.RLock()
+	factory, ok := schedulers[name]
+	schedulersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown scheduler %q", name)
+	}
+	return factory(), nil
+}
+
+// fifoScheduler runs every execution as soon as its delay elapses, oldest first
+type fifoScheduler struct{}
+
+func (fifoScheduler) Schedule(arrived []*Execution, due []*Execution) ([]*Execution, []*Execution) {
+	sortByAge(due)
+	return due, nil
+}
+
+// sortByAge orders executions oldest first
+func sortByAge(executions []*Execution) {
+	sort.SliceStable(executions, func(i, j int) bool {
+		return executions[i].queuedAt < executions[j].queuedAt
+	})
+}
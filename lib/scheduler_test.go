@@ -0,0 +1,80 @@
+package lib
+
+import (
+	"fmt"
+	"sync"
+)
+
+// holdScheduler defers every due execution, for testing the deferral path of the queue
+type holdScheduler struct{}
+
+func (holdScheduler) Schedule(arrived []*Execution, due []*Execution) ([]*Execution, []*Execution) {
+	return nil, due
+}
+
+func (s *TestSuite) TestFIFOSchedulerOrdersByArrival() {
+	query := getQuery(CPU)
+	due := []*Execution{
+		{query: query, queuedAt: 3},
+		{query: query, queuedAt: 1},
+		{query: query, queuedAt: 2},
+	}
+	run, deferred := fifoScheduler{}.Schedule(nil, due)
+	s.Empty(deferred)
+	s.Len(run, 3)
+	for i, execution := range run {
+		s.Equal(i+1, execution.queuedAt)
+	}
+}
+
+func (s *TestSuite) TestQueueDefersToScheduler() {
+	queries := getQueries(100)
+	for _, query := range queries {
+		query.priority = PriorityLow
+	}
+	probs := getExecutionProbs(100)
+	queue := newQueue(queries, probs, 1)
+	queue.scheduler = holdScheduler{}
+
+	arrived := 0
+	for i := 0; i < 100; i++ {
+		queued, executed := queue.tick(1)
+		arrived += len(queued)
+		s.Empty(executed)
+	}
+	s.Equal(arrived, len(queue.queued))
+	for _, execution := range queue.queued {
+		s.Equal(1, execution.delay)
+	}
+}
+
+func (s *TestSuite) TestNewScheduler() {
+	scheduler, err := newScheduler(FIFOScheduler)
+	s.NoError(err)
+	s.IsType(fifoScheduler{}, scheduler)
+
+	_, err = newScheduler("missing")
+	s.Error(err)
+
+	RegisterScheduler("hold", func() Scheduler { return holdScheduler{} })
+	scheduler, err = newScheduler("hold")
+	s.NoError(err)
+	s.IsType(holdScheduler{}, scheduler)
+}
+
+func (s *TestSuite) TestRegisterSchedulerConcurrently() {
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			RegisterScheduler(fmt.Sprintf("hold-%d", i), func() Scheduler { return holdScheduler{} })
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := newScheduler(FIFOScheduler)
+			s.NoError(err)
+		}()
+	}
+	wg.Wait()
+}
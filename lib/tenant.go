@@ -0,0 +1,112 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// DefaultTenant owns every query template when no tenants are configured, and the templates of
+// scheduled work such as recurring jobs and maintenance
+const DefaultTenant = "default"
+
+// ErrTenantQuota is returned when a delay would hold an execution longer than its tenant allows
+var ErrTenantQuota = errors.New("delay exceeds the tenant's delay quota")
+
+// TenantConfig is a customer that owns a share of the query templates
+type TenantConfig struct {
+	Name     string  `json:"name"`
+	Weight   float64 `json:"weight"`    // Weight is the relative share of generated query templates the tenant owns
+	MaxDelay int     `json:"max_delay"` // MaxDelay is the most ticks an execution may be held past its default delay, 0 for no limit
+}
+
+func validateTenants(tenants []TenantConfig) error {
+	seen := make(map[string]bool, len(tenants))
+	total := 0.0
+	for _, tenant := range tenants {
+		if tenant.Name == "" || seen[tenant.Name] {
+			return fmt.Errorf("tenants need a unique name")
+		}
+		seen[tenant.Name] = true
+		if tenant.Weight < 0 || tenant.MaxDelay < 0 {
+			return fmt.Errorf("tenant %s must not have a negative weight or max_delay", tenant.Name)
+		}
+		total += tenant.Weight
+	}
+	if len(tenants) > 0 && total == 0 {
+		return fmt.Errorf("tenants need a positive total weight")
+	}
+	return nil
+}
+
+// assignTenants draws the tenant of each query from the configured weights. Without tenants, every
+// query keeps the default tenant.
+func assignTenants(queries []*Query, tenants []TenantConfig, rng randSource) {
+	total := 0.0
+	for _, tenant := range tenants {
+		total += tenant.Weight
+	}
+	if total == 0 {
+		return
+	}
+	for _, query := range queries {
+		draw := rng.Float64() * total
+		for _, tenant := range tenants {
+			draw -= tenant.Weight
+			if draw < 0 {
+				query.tenant = tenant.Name
+				break
+			}
+		}
+	}
+}
+
+// validateQueryTenants checks that every query belongs to a configured tenant or the default one
+func validateQueryTenants(queries []*Query, tenants []TenantConfig) error {
+	if len(tenants) == 0 {
+		return nil
+	}
+	for _, query := range queries {
+		known := slices.ContainsFunc(tenants, func(tenant TenantConfig) bool { return tenant.Name == query.tenant })
+		if !known && query.tenant != DefaultTenant {
+			return fmt.Errorf("query %s belongs to unknown tenant %q", query.id, query.tenant)
+		}
+	}
+	return nil
+}
+
+// tenantNames lists the default tenant and the configured ones
+func tenantNames(tenants []TenantConfig) []string {
+	names := []string{DefaultTenant}
+	for _, tenant := range tenants {
+		if tenant.Name != DefaultTenant {
+			names = append(names, tenant.Name)
+		}
+	}
+	return names
+}
+
+// overQuota reports whether holding the execution until it is due in the given number of ticks
+// would keep it past its default delay for longer than its tenant allows. The delay added by the
+// scheduler, the budget and the delay API all count.
+func (q *Queue) overQuota(execution *Execution, delay int) bool {
+	limit := q.tenantDelay[execution.tenant]
+	return limit > 0 && q.ticks+delay-execution.queuedAt-q.defaultDelay > limit
+}
+
+// enforce applies the policies a scheduler or the budget may not override. Executions that may not
+// be deferred run, as do those whose tenant's delay quota is used up, and transactions stay together.
+func (q *Queue) enforce(run []*Execution, deferred []*Execution) ([]*Execution, []*Execution) {
+	mustRun := func(execution *Execution) bool {
+		return !execution.priority.deferrable() || q.overQuota(execution, max(1, execution.delay))
+	}
+	kept := make([]*Execution, 0, len(deferred))
+	for _, execution := range deferred {
+		if mustRun(execution) {
+			run = append(run, execution)
+		} else {
+			kept = append(kept, execution)
+		}
+	}
+	return keepTogether(run, kept, mustRun)
+}
@@ -0,0 +1,123 @@
+package lib
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func (s *TestSuite) TestAssignTenants() {
+	queries := getQueries(1000)
+	for _, query := range queries {
+		s.Equal(DefaultTenant, query.tenant)
+	}
+	assignTenants(queries, []TenantConfig{{Name: "acme", Weight: 3}, {Name: "globex", Weight: 1}}, processRand{})
+	counts := make(map[string]int)
+	for _, query := range queries {
+		counts[query.tenant]++
+	}
+	s.InDelta(750, counts["acme"], 75)
+	s.InDelta(250, counts["globex"], 75)
+
+	s.NoError(validateQueryTenants(queries, []TenantConfig{{Name: "acme"}, {Name: "globex"}}))
+	s.Error(validateQueryTenants(queries, []TenantConfig{{Name: "acme"}}))
+	s.Error(validateTenants([]TenantConfig{{Name: "acme", Weight: 1}, {Name: "acme", Weight: 1}}))
+	s.Error(validateTenants([]TenantConfig{{Name: "acme", Weight: 1, MaxDelay: -1}}))
+	s.Error(validateTenants([]TenantConfig{{Name: "acme"}}))
+}
+
+func (s *TestSuite) TestTenantDelayQuota() {
+	queries := getQueries(2)
+	for i, query := range queries {
+		query.priority = PriorityLow
+		query.tenant = []string{"acme", "globex"}[i]
+	}
+	queue := newQueue(queries, &[]float64{0, 0}, 1)
+	queue.scheduler = holdScheduler{}
+	queue.tenantDelay = map[string]int{"acme": 3}
+	acme := newExecution(queries[0], uuid.New(), 1)
+	globex := newExecution(queries[1], uuid.New(), 1)
+	queue.queued[acme.id] = acme
+	queue.queued[globex.id] = globex
+
+	// Both were queued on tick 0, so acme's may be held until tick 4 and runs then
+	for tick := 1; tick <= 3; tick++ {
+		_, executed := queue.tick(1)
+		s.Empty(executed, tick)
+	}
+	_, executed := queue.tick(1)
+	s.Equal([]*Execution{acme}, executed)
+	s.Contains(queue.queued, globex.id)
+}
+
+func (s *TestSuite) TestDelayRefusesPastTenantQuota() {
+	query := getQuery(CPU)
+	query.tenant = "acme"
+	queue := newQueue([]*Query{query}, &[]float64{0}, 1)
+	queue.tenantDelay = map[string]int{"acme": 5}
+	execution := newExecution(query, uuid.New(), 1)
+	queue.queued[execution.id] = execution
+
+	s.NoError(queue.delay(execution.id, 5))
+	s.ErrorIs(queue.delay(execution.id, 1), ErrTenantQuota)
+	s.Equal(6, execution.delay)
+}
+
+func (s *TestSuite) TestTenantUsage() {
+	acme, globex := getQuery(CPU), getQuery(IO)
+	acme.tenant, globex.tenant = "acme", "globex"
+	running := newRunSet()
+	running.tenants = true
+	running.start([]*Execution{
+		{query: acme, tenant: "acme", duration: 1, usage: Resources{ResourceCPU: 10, ResourceIO: 1}},
+		{query: acme, tenant: "acme", duration: 1, usage: Resources{ResourceCPU: 5}},
+		{query: globex, tenant: "globex", duration: 1, usage: Resources{ResourceIO: 7}},
+	})
+	update := running.tick()
+	s.Equal(Resources{ResourceCPU: 15, ResourceIO: 1}, update.Tenants["acme"])
+	s.Equal(Resources{ResourceIO: 7}, update.Tenants["globex"])
+	s.Equal(Resources{ResourceCPU: 15, ResourceIO: 8}, update.Usage)
+
+	monitor := newMonitor(time.Second, 10, []string{ResourceCPU, ResourceIO})
+	monitor.trackTenants([]string{DefaultTenant, "acme"})
+	monitor.update(update.Usage)
+	monitor.updateTenants(update.Tenants)
+	monitor.update(Resources{})
+	monitor.updateTenants(map[string]Resources{})
+	monitor.aggregate()
+
+	metrics := monitor.getResources()
+	s.Equal(ResourceUsage{Average: 7, Min: 0, Max: 15}, metrics.Tenants["acme"][ResourceCPU])
+	s.Equal(ResourceUsage{Average: 3, Min: 0, Max: 7}, metrics.Tenants["globex"][ResourceIO])
+	s.Equal(ResourceUsage{}, metrics.Tenants[DefaultTenant][ResourceCPU])
+
+	data, err := metrics.MarshalJSON()
+	s.NoError(err)
+	var decoded ResourceMetrics
+	s.NoError(decoded.UnmarshalJSON(data))
+	s.Equal([]string{ResourceCPU, ResourceIO}, decoded.Dimensions())
+	s.Equal(metrics.Tenants, decoded.Tenants)
+}
+
+func (s *TestSuite) TestTenantCatalogAndLatency() {
+	query := getQuery(CPU)
+	query.tenant = "acme"
+	var b strings.Builder
+	s.NoError(WriteCatalogCSV(&b, newCatalog([]*Query{query}, &[]float64{0.5})))
+	catalog, err := readCatalogCSV(strings.NewReader(b.String()))
+	s.NoError(err)
+	s.Equal("acme", catalog[0].Tenant)
+
+	var entry CatalogEntry
+	s.NoError(entry.UnmarshalJSON([]byte(`{"cpu":1,"memory":1,"io":1,"probability":0.1}`)))
+	s.Equal(DefaultTenant, entry.Tenant)
+
+	recorder := newLatencyRecorder()
+	recorder.byTenant = make(map[string]*latencySplit)
+	recorder.record([]*Execution{newExecution(query, uuid.New(), 1)}, 3, 1)
+	metrics := recorder.snapshot(10)
+	s.Require().Len(metrics.Tenants, 1)
+	s.Equal("acme", metrics.Tenants[0].Tenant)
+	s.Equal(1, metrics.Tenants[0].Total.Count)
+}
@@ -0,0 +1,644 @@
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	NDJSONTrace = "ndjson" // one JSON record per line
+	BinaryTrace = "binary" // a JSON catalog followed by varint-encoded arrivals
+)
+
+// binaryTraceMagic starts every binary trace, which is how the reader tells the formats apart.
+// Its last byte is the version: version 1 traces only hold the tick, query and ID of each arrival.
+var (
+	binaryTraceMagic   = []byte("QTRC\x02")
+	binaryTraceMagicV1 = []byte("QTRC\x01")
+)
+
+// Record types of a binary trace, each written as a byte before the record
+const (
+	binaryArrival  byte = iota
+	binaryTemplate      // a query template added to the catalog during the run, as JSON
+)
+
+// Flags of an arrival in a binary trace
+const (
+	binaryMaintenance byte = 1 << iota
+	binaryGrouped
+)
+
+// TraceConfig controls recording arrivals to a trace file and replaying them from one
+type TraceConfig struct {
+	Record string `json:"record"` // Record is the path arrivals are recorded to, empty to disable recording
+	Format string `json:"format"` // Format is the format of the recorded trace
+	Replay string `json:"replay"` // Replay is the path of a trace to take the catalog and arrivals from, empty to disable replay
+}
+
+func defaultTraceConfig() TraceConfig {
+	return TraceConfig{Format: NDJSONTrace}
+}
+
+func (c TraceConfig) validate() error {
+	if c.Format != NDJSONTrace && c.Format != BinaryTrace {
+		return fmt.Errorf("unknown trace format %q", c.Format)
+	}
+	if c.Record != "" && c.Record == c.Replay {
+		return fmt.Errorf("cannot record to the trace being replayed")
+	}
+	return nil
+}
+
+// traceRecord is a line of an NDJSON trace: the catalog, a template added to it during the run
+// or an arrival. An arrival holds what was drawn for the execution as well, so that replaying it
+// does not draw again.
+type traceRecord struct {
+	Type      string         `json:"type"`
+	Queries   []CatalogEntry `json:"queries,omitempty"`
+	Tick      int            `json:"tick,omitempty"`
+	Query     string         `json:"query,omitempty"`
+	Execution string         `json:"execution,omitempty"`
+	Usage     Resources      `json:"usage,omitempty"`
+	Duration  int            `json:"duration,omitempty"` // Duration is missing from traces recorded before it was, whose arrivals take their query's
+	Kind      ExecutionKind  `json:"kind,omitempty"`
+	FinishBy  int            `json:"finish_by,omitempty"`
+	Group     *traceGroup    `json:"group,omitempty"`
+}
+
+// traceGroup is the group of a recorded arrival
+type traceGroup struct {
+	ID       uuid.UUID `json:"id"`
+	Name     string    `json:"name"`
+	Type     GroupType `json:"type"`
+	Position int       `json:"position"`
+}
+
+// traceArrival is an arrival read back from a trace
+type traceArrival struct {
+	tick      int
+	query     uuid.UUID
+	execution uuid.UUID
+	recorded  bool // recorded is set when the trace holds the values below, which older traces do not
+	usage     Resources
+	duration  int
+	kind      ExecutionKind
+	finishBy  int
+	group     *traceGroup
+}
+
+// newTraceArrival returns the arrival of the execution as it is recorded
+func newTraceArrival(tick int, execution *Execution) traceArrival {
+	arrival := traceArrival{
+		tick:      tick,
+		query:     execution.query.id,
+		execution: execution.id,
+		recorded:  true,
+		usage:     execution.usage,
+		duration:  execution.duration,
+		kind:      execution.kind,
+		finishBy:  execution.finishBy,
+	}
+	if g := execution.group; g != nil {
+		arrival.group = &traceGroup{ID: g.id, Name: g.name, Type: g.kind, Position: execution.position}
+	}
+	return arrival
+}
+
+// traceRecorder writes the catalog and every arrival to a trace file
+type traceRecorder struct {
+	file    *os.File
+	writer  *bufio.Writer
+	format  string
+	indices map[uuid.UUID]int // indices maps query IDs to their catalog index, for the binary format
+	buf     []byte
+}
+
+func newTraceRecorder(path string, format string, catalog []CatalogEntry) (*traceRecorder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &traceRecorder{
+		file:    file,
+		writer:  bufio.NewWriter(file),
+		format:  format,
+		indices: make(map[uuid.UUID]int, len(catalog)),
+	}
+	for i, entry := range catalog {
+		r.indices[entry.ID] = i
+	}
+
+	if err := r.writeCatalog(catalog); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *traceRecorder) writeCatalog(catalog []CatalogEntry) error {
+	if r.format == NDJSONTrace {
+		if err := r.writeRecord(traceRecord{Type: "catalog", Queries: catalog}); err != nil {
+			return err
+		}
+		return r.writer.Flush()
+	}
+
+	data, err := json.Marshal(catalog)
+	if err != nil {
+		return err
+	}
+	r.writer.Write(binaryTraceMagic)
+	r.writer.Write(binary.AppendUvarint(nil, uint64(len(data))))
+	r.writer.Write(data)
+	return r.writer.Flush()
+}
+
+func (r *traceRecorder) writeRecord(record traceRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	r.writer.Write(data)
+	return r.writer.WriteByte('\n')
+}
+
+// record appends the arrivals of a tick to the trace and flushes it, so the trace survives a crash
+func (r *traceRecorder) record(tick int, executions []*Execution) error {
+	if len(executions) == 0 {
+		return nil
+	}
+	for _, execution := range executions {
+		if _, ok := r.indices[execution.query.id]; !ok {
+			if err := r.writeTemplate(execution.query); err != nil {
+				return err
+			}
+		}
+		arrival := newTraceArrival(tick, execution)
+		if r.format == NDJSONTrace {
+			if err := r.writeRecord(traceRecord{
+				Type:      "arrival",
+				Tick:      arrival.tick,
+				Query:     arrival.query.String(),
+				Execution: arrival.execution.String(),
+				Usage:     arrival.usage,
+				Duration:  arrival.duration,
+				Kind:      arrival.kind,
+				FinishBy:  arrival.finishBy,
+				Group:     arrival.group,
+			}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		r.writer.Write(r.appendArrival(r.buf[:0], r.indices[arrival.query], arrival))
+	}
+	return r.writer.Flush()
+}
+
+// writeTemplate records a query template that was not in the catalog, such as one introduced by
+// churn, ahead of its first arrival. Its probability is not recorded, as replay takes the arrivals
+// from the trace.
+func (r *traceRecorder) writeTemplate(query *Query) error {
+	entry := newCatalog([]*Query{query}, &[]float64{0})[0]
+	r.indices[query.id] = len(r.indices)
+	if r.format == NDJSONTrace {
+		return r.writeRecord(traceRecord{Type: "template", Queries: []CatalogEntry{entry}})
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	r.buf = append(r.buf[:0], binaryTemplate)
+	r.buf = binary.AppendUvarint(r.buf, uint64(len(data)))
+	r.writer.Write(append(r.buf, data...))
+	return nil
+}
+
+// appendArrival encodes an arrival of the binary format: its tick, query index, ID, duration and
+// flags, the window of a maintenance task, the usage and the group of a member of one
+func (r *traceRecorder) appendArrival(buf []byte, idx int, arrival traceArrival) []byte {
+	var flags byte
+	if arrival.kind == KindMaintenance {
+		flags |= binaryMaintenance
+	}
+	if arrival.group != nil {
+		flags |= binaryGrouped
+	}
+	buf = append(buf, binaryArrival)
+	buf = binary.AppendUvarint(buf, uint64(arrival.tick))
+	buf = binary.AppendUvarint(buf, uint64(idx))
+	buf = append(buf, arrival.execution[:]...)
+	buf = binary.AppendUvarint(buf, uint64(arrival.duration))
+	buf = append(buf, flags)
+	if flags&binaryMaintenance != 0 {
+		buf = binary.AppendUvarint(buf, uint64(arrival.finishBy))
+	}
+	names := arrival.usage.names()
+	buf = binary.AppendUvarint(buf, uint64(len(names)))
+	for _, name := range names {
+		buf = appendString(buf, name)
+		buf = binary.AppendVarint(buf, int64(arrival.usage[name]))
+	}
+	if group := arrival.group; group != nil {
+		buf = append(buf, group.ID[:]...)
+		buf = binary.AppendUvarint(buf, uint64(group.Position))
+		buf = appendString(buf, string(group.Type))
+		buf = appendString(buf, group.Name)
+	}
+	r.buf = buf
+	return buf
+}
+
+// appendString encodes a string of the binary format as its length and bytes
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+func (r *traceRecorder) close() error {
+	if err := r.writer.Flush(); err != nil {
+		r.file.Close()
+		return err
+	}
+	return r.file.Close()
+}
+
+// traceReader reads the arrivals of a trace in order
+type traceReader struct {
+	file      *os.File
+	reader    *bufio.Reader
+	binary    bool
+	version   byte // version is the version of a binary trace
+	ids       []uuid.UUID
+	indices   map[uuid.UUID]int
+	templates []CatalogEntry // templates are those added to the catalog since the last arrival was read
+}
+
+// addTemplate adds a template recorded during the run to the catalog, so arrivals can reference it
+func (r *traceReader) addTemplate(entry CatalogEntry) {
+	if _, ok := r.indices[entry.ID]; !ok {
+		r.indices[entry.ID] = len(r.ids)
+		r.ids = append(r.ids, entry.ID)
+	}
+	r.templates = append(r.templates, entry)
+}
+
+// openTrace opens a trace of either format and reads its catalog
+func openTrace(path string) (*traceReader, []CatalogEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	r := &traceReader{file: file, reader: bufio.NewReader(file)}
+	catalog, err := r.readCatalog()
+	if err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("invalid trace %s: %w", path, err)
+	}
+
+	r.indices = make(map[uuid.UUID]int, len(catalog))
+	for i, entry := range catalog {
+		r.indices[entry.ID] = i
+		r.ids = append(r.ids, entry.ID)
+	}
+	return r, catalog, nil
+}
+
+func (r *traceReader) readCatalog() ([]CatalogEntry, error) {
+	magic, err := r.reader.Peek(len(binaryTraceMagic))
+	if err == nil && (bytes.Equal(magic, binaryTraceMagic) || bytes.Equal(magic, binaryTraceMagicV1)) {
+		r.binary = true
+		r.version = magic[len(magic)-1]
+		r.reader.Discard(len(binaryTraceMagic))
+		length, err := binary.ReadUvarint(r.reader)
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, length)
+		if _, err := io.ReadFull(r.reader, data); err != nil {
+			return nil, err
+		}
+		var catalog []CatalogEntry
+		return catalog, json.Unmarshal(data, &catalog)
+	}
+
+	record, err := r.readRecord()
+	if err != nil {
+		return nil, err
+	}
+	if record.Type != "catalog" {
+		return nil, fmt.Errorf("trace does not start with a catalog")
+	}
+	return record.Queries, nil
+}
+
+func (r *traceReader) readRecord() (traceRecord, error) {
+	var record traceRecord
+	line, err := r.reader.ReadBytes('\n')
+	if len(line) == 0 && err != nil {
+		return record, err
+	}
+	return record, json.Unmarshal(line, &record)
+}
+
+// next returns the next arrival in the trace, or io.EOF once it is exhausted
+func (r *traceReader) next() (traceArrival, error) {
+	if r.binary {
+		return r.nextBinary()
+	}
+
+	record, err := r.readRecord()
+	for err == nil && record.Type == "template" {
+		for _, entry := range record.Queries {
+			r.addTemplate(entry)
+		}
+		record, err = r.readRecord()
+	}
+	if err != nil {
+		return traceArrival{}, err
+	}
+	query, err := uuid.Parse(record.Query)
+	if err != nil {
+		return traceArrival{}, err
+	}
+	if _, ok := r.indices[query]; !ok {
+		return traceArrival{}, fmt.Errorf("arrival references unknown query %s", record.Query)
+	}
+	execution, err := uuid.Parse(record.Execution)
+	if err != nil {
+		return traceArrival{}, err
+	}
+	return traceArrival{
+		tick:      record.Tick,
+		query:     query,
+		execution: execution,
+		recorded:  record.Duration > 0,
+		usage:     record.Usage,
+		duration:  record.Duration,
+		kind:      record.Kind,
+		finishBy:  record.FinishBy,
+		group:     record.Group,
+	}, nil
+}
+
+func (r *traceReader) nextBinary() (traceArrival, error) {
+	for r.version > 1 {
+		kind, err := r.reader.ReadByte()
+		if err != nil {
+			return traceArrival{}, err
+		}
+		if kind == binaryArrival {
+			break
+		}
+		if kind != binaryTemplate {
+			return traceArrival{}, fmt.Errorf("unknown record type %d", kind)
+		}
+		if err := r.readTemplate(); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return traceArrival{}, err
+		}
+	}
+	tick, err := binary.ReadUvarint(r.reader)
+	if err != nil {
+		if r.version > 1 {
+			return traceArrival{}, io.ErrUnexpectedEOF
+		}
+		return traceArrival{}, err
+	}
+	idx, err := binary.ReadUvarint(r.reader)
+	if err != nil {
+		return traceArrival{}, io.ErrUnexpectedEOF
+	}
+	if idx >= uint64(len(r.ids)) {
+		return traceArrival{}, fmt.Errorf("arrival references unknown query index %d", idx)
+	}
+	arrival := traceArrival{tick: int(tick), query: r.ids[idx]}
+	if _, err := io.ReadFull(r.reader, arrival.execution[:]); err != nil {
+		return traceArrival{}, io.ErrUnexpectedEOF
+	}
+	if r.version == 1 {
+		return arrival, nil
+	}
+
+	if err := r.readDrawn(&arrival); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return traceArrival{}, err
+	}
+	return arrival, nil
+}
+
+// readTemplate reads a template record of the binary format, following its type
+func (r *traceReader) readTemplate() error {
+	length, err := binary.ReadUvarint(r.reader)
+	if err != nil {
+		return err
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r.reader, data); err != nil {
+		return err
+	}
+	var entry CatalogEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return err
+	}
+	r.addTemplate(entry)
+	return nil
+}
+
+// readDrawn reads what was drawn for a binary arrival, following its ID
+func (r *traceReader) readDrawn(arrival *traceArrival) error {
+	duration, err := binary.ReadUvarint(r.reader)
+	if err != nil {
+		return err
+	}
+	flags, err := r.reader.ReadByte()
+	if err != nil {
+		return err
+	}
+	arrival.recorded = true
+	arrival.duration = int(duration)
+	arrival.kind = KindQuery
+	if flags&binaryMaintenance != 0 {
+		arrival.kind = KindMaintenance
+		finishBy, err := binary.ReadUvarint(r.reader)
+		if err != nil {
+			return err
+		}
+		arrival.finishBy = int(finishBy)
+	}
+
+	count, err := binary.ReadUvarint(r.reader)
+	if err != nil {
+		return err
+	}
+	arrival.usage = make(Resources, count)
+	for i := uint64(0); i < count; i++ {
+		name, err := r.readString()
+		if err != nil {
+			return err
+		}
+		usage, err := binary.ReadVarint(r.reader)
+		if err != nil {
+			return err
+		}
+		arrival.usage[name] = int(usage)
+	}
+
+	if flags&binaryGrouped == 0 {
+		return nil
+	}
+	group := &traceGroup{}
+	if _, err := io.ReadFull(r.reader, group.ID[:]); err != nil {
+		return err
+	}
+	position, err := binary.ReadUvarint(r.reader)
+	if err != nil {
+		return err
+	}
+	group.Position = int(position)
+	kind, err := r.readString()
+	if err != nil {
+		return err
+	}
+	group.Type = GroupType(kind)
+	if group.Name, err = r.readString(); err != nil {
+		return err
+	}
+	arrival.group = group
+	return nil
+}
+
+// readString reads a string of the binary format, written by appendString
+func (r *traceReader) readString() (string, error) {
+	length, err := binary.ReadUvarint(r.reader)
+	if err != nil {
+		return "", err
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r.reader, data); err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// traceReplay feeds the queue the arrivals of a trace instead of drawing them from the arrival model
+type traceReplay struct {
+	reader  *traceReader
+	pending *traceArrival // pending is the next arrival, read ahead of its tick
+	done    bool
+	queries map[uuid.UUID]*Query // queries are the query templates of the queue by ID, looked up on first use
+}
+
+func newTraceReplay(reader *traceReader) *traceReplay {
+	return &traceReplay{reader: reader}
+}
+
+// arrivals returns the executions recorded for the queue's current tick
+func (r *traceReplay) arrivals(q *Queue) []*Execution {
+	if r.queries == nil {
+		q.catalogMu.RLock()
+		r.queries = make(map[uuid.UUID]*Query, len(q.queries))
+		for _, query := range q.queries {
+			r.queries[query.id] = query
+		}
+		q.catalogMu.RUnlock()
+	}
+
+	executions := make([]*Execution, 0)
+	groups := make(map[uuid.UUID]*group)
+	for !r.done {
+		if r.pending == nil {
+			arrival, err := r.reader.next()
+			if err != nil {
+				if !errors.Is(err, io.EOF) {
+					log.Err(err).Msg("Stopping trace replay")
+				} else {
+					log.Info().Int("Tick", q.ticks).Msg("Trace replay finished")
+				}
+				r.done = true
+				r.reader.file.Close()
+				break
+			}
+			r.pending = &arrival
+			r.addTemplates(q)
+		}
+		if r.pending.tick > q.ticks {
+			break
+		}
+		if r.pending.tick == q.ticks && r.queries[r.pending.query] != nil {
+			executions = append(executions, r.execution(*r.pending, q.defaultDelay, groups))
+		}
+		r.pending = nil
+	}
+	return executions
+}
+
+// addTemplates adds the templates read since the last arrival to the catalog of the queue. They
+// do not arrive other than from the trace, so they are added with a probability of 0.
+func (r *traceReplay) addTemplates(q *Queue) {
+	for _, entry := range r.reader.templates {
+		if r.queries[entry.ID] != nil {
+			continue
+		}
+		queries, _, err := queriesFromCatalog([]CatalogEntry{entry})
+		if err != nil {
+			log.Err(err).Msg("Skipping trace template")
+			continue
+		}
+		q.catalogMu.Lock()
+		q.queries = append(q.queries, queries[0])
+		*q.probs = append(*q.probs, 0)
+		q.catalogMu.Unlock()
+		r.queries[entry.ID] = queries[0]
+	}
+	r.reader.templates = r.reader.templates[:0]
+}
+
+// execution recreates a recorded arrival, with the usage, duration, kind and group it was recorded
+// with. The members of a group arrive on the same tick, so they are put back together by its ID.
+func (r *traceReplay) execution(arrival traceArrival, delay int, groups map[uuid.UUID]*group) *Execution {
+	execution := newExecution(r.queries[arrival.query], arrival.execution, delay)
+	if !arrival.recorded {
+		return execution
+	}
+	execution.usage = arrival.usage
+	if execution.usage == nil {
+		execution.usage = make(Resources)
+	}
+	execution.duration = arrival.duration
+	if arrival.kind != "" {
+		execution.kind = arrival.kind
+	}
+	execution.finishBy = arrival.finishBy
+
+	if recorded := arrival.group; recorded != nil {
+		g, ok := groups[recorded.ID]
+		if !ok {
+			g = &group{id: recorded.ID, name: recorded.Name, kind: recorded.Type}
+			groups[recorded.ID] = g
+		}
+		for len(g.members) <= recorded.Position {
+			g.members = append(g.members, nil)
+		}
+		g.members[recorded.Position] = execution
+		execution.group = g
+		execution.position = recorded.Position
+	}
+	return execution
+}
@@ -0,0 +1,195 @@
+package lib
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/google/uuid"
+)
+
+// assertReplays records the arrivals of a run with the config in each trace format, replays them
+// with the same config and checks every execution arrives again as it was drawn. It returns the
+// recorded executions, for the caller to check the run exercised what it tests.
+func (s *TestSuite) assertReplays(cfg Config, ticks int) []*Execution {
+	var all []*Execution
+	for _, format := range []string{NDJSONTrace, BinaryTrace} {
+		cfg := cfg
+		cfg.Trace = TraceConfig{Record: filepath.Join(s.T().TempDir(), "trace."+format), Format: format}
+		db, err := NewDBWithConfig(cfg)
+		s.Require().NoError(err)
+		recorded := make([][]*Execution, ticks)
+		for i := range recorded {
+			recorded[i], _ = db.queue.tick(1)
+		}
+		s.Require().NoError(db.queue.recorder.close())
+		all = slices.Concat(recorded...)
+
+		cfg.Trace = TraceConfig{Replay: cfg.Trace.Record, Format: format}
+		cfg.Seed++
+		replay, err := NewDBWithConfig(cfg)
+		s.Require().NoError(err)
+		for i := range recorded {
+			arrived, _ := replay.queue.tick(1)
+			s.Require().Len(arrived, len(recorded[i]), format)
+			for j, execution := range arrived {
+				want := recorded[i][j]
+				s.Equal(want.id, execution.id, format)
+				s.Equal(want.query.id, execution.query.id, format)
+				s.Equal(want.usage, execution.usage, format)
+				s.Equal(want.duration, execution.duration, format)
+				s.Equal(want.kind, execution.kind, format)
+				s.Equal(want.finishBy, execution.finishBy, format)
+				s.Equal(want.deadline, execution.deadline, format)
+				s.Equal(want.group == nil, execution.group == nil, format)
+				if want.group != nil {
+					s.Equal(want.group.id, execution.group.id, format)
+					s.Equal(want.group.kind, execution.group.kind, format)
+					s.Equal(want.position, execution.position, format)
+					s.Len(execution.group.members, len(want.group.members), format)
+				}
+			}
+		}
+	}
+	return all
+}
+
+func (s *TestSuite) TestTraceRecordAndReplay() {
+	for _, format := range []string{NDJSONTrace, BinaryTrace} {
+		path := filepath.Join(s.T().TempDir(), "trace."+format)
+		queries := getQueries(100)
+		probs := getExecutionProbs(100)
+		assignPriorities(queries, PriorityConfig{Weights: map[Priority]float64{PriorityLow: 1, PriorityNormal: 1, PriorityHigh: 1}}, processRand{})
+
+		recorder, err := newTraceRecorder(path, format, newCatalog(queries, probs))
+		s.NoError(err)
+		queue := newQueue(queries, probs, 1)
+		queue.arrivals = poissonModel{rng: processRand{}}
+		queue.recorder = recorder
+
+		recorded := make([][]*Execution, 0)
+		for i := 0; i < 200; i++ {
+			arrived, _ := queue.tick(2)
+			recorded = append(recorded, arrived)
+		}
+		s.NoError(recorder.close())
+
+		reader, catalog, err := openTrace(path)
+		s.NoError(err)
+		s.Equal(newCatalog(queries, probs), catalog)
+		replayedQueries, replayedProbs, err := queriesFromCatalog(catalog)
+		s.NoError(err)
+		s.Equal(*probs, *replayedProbs)
+
+		replay := newQueue(replayedQueries, replayedProbs, 1)
+		replay.replay = newTraceReplay(reader)
+		for i := 0; i < 200; i++ {
+			arrived, _ := replay.tick(2)
+			s.Len(arrived, len(recorded[i]), format)
+			for j, execution := range arrived {
+				s.Equal(recorded[i][j].id, execution.id)
+				s.Equal(recorded[i][j].query.id, execution.query.id)
+				s.Equal(recorded[i][j].priority, execution.priority)
+			}
+		}
+
+		arrived, _ := replay.tick(2)
+		s.Empty(arrived)
+		s.True(replay.replay.done)
+	}
+}
+
+func (s *TestSuite) TestQueriesFromCatalogRejectsDuplicates() {
+	queries := getQueries(2)
+	catalog := newCatalog(queries, getExecutionProbs(2))
+	catalog[1].ID = catalog[0].ID
+	_, _, err := queriesFromCatalog(catalog)
+	s.Error(err)
+}
+
+func (s *TestSuite) TestTraceReplaysRecurringAndGroups() {
+	cfg := DefaultConfig()
+	cfg.Seed = 7
+	cfg.Recurring = []RecurringJob{{Name: "backup", Every: 5, Duration: 3, Shape: FlatShape, Priority: PriorityLow, Usage: Resources{ResourceIO: 50}}}
+	cfg.Groups = []GroupConfig{
+		{Name: "etl", Type: GroupChain, Queries: []string{"cpu-0", "io-1", "memory-2"}, Rate: 0.3},
+		{Name: "transfer", Type: GroupTransaction, Queries: []string{"cpu-3", "io-4"}, Rate: 0.3},
+	}
+	executions := s.assertReplays(cfg, 50)
+	s.True(slices.ContainsFunc(executions, func(e *Execution) bool { return e.query.name == "backup" }))
+	s.True(slices.ContainsFunc(executions, func(e *Execution) bool { return e.group != nil && e.group.kind == GroupChain }))
+	s.True(slices.ContainsFunc(executions, func(e *Execution) bool { return e.group != nil && e.group.kind == GroupTransaction }))
+}
+
+func (s *TestSuite) TestReadVersion1Trace() {
+	queries := getQueries(2)
+	probs := getExecutionProbs(2)
+	data, err := json.Marshal(newCatalog(queries, probs))
+	s.Require().NoError(err)
+
+	// A version 1 trace only holds the tick, query index and ID of each arrival
+	id := uuid.New()
+	trace := slices.Concat(binaryTraceMagicV1, binary.AppendUvarint(nil, uint64(len(data))), data)
+	trace = binary.AppendUvarint(trace, 3)
+	trace = binary.AppendUvarint(trace, 1)
+	trace = append(trace, id[:]...)
+	path := filepath.Join(s.T().TempDir(), "trace.bin")
+	s.Require().NoError(os.WriteFile(path, trace, 0644))
+
+	reader, _, err := openTrace(path)
+	s.Require().NoError(err)
+	replay := newQueue(queries, probs, 1)
+	replay.replay = newTraceReplay(reader)
+	for tick := 1; tick < 3; tick++ {
+		arrived, _ := replay.tick(1)
+		s.Empty(arrived)
+	}
+	arrived, _ := replay.tick(1)
+	s.Require().Len(arrived, 1)
+	s.Equal(id, arrived[0].id)
+	s.Equal(queries[1].usage, arrived[0].usage)
+	s.Equal(queries[1].duration, arrived[0].duration)
+}
+
+func (s *TestSuite) TestTraceReplaysDrawnDurations() {
+	cfg := DefaultConfig()
+	cfg.Seed = 3
+	cfg.Durations = DurationConfig{Mean: 10, Spread: 0.5, Shape: FlatShape}
+	executions := s.assertReplays(cfg, 20)
+	s.True(slices.ContainsFunc(executions, func(e *Execution) bool { return e.duration != e.query.duration }))
+}
+
+func (s *TestSuite) TestTraceReplaysNoisyUsage() {
+	cfg := DefaultConfig()
+	cfg.Seed = 5
+	cfg.Resources = []ResourceConfig{{Name: "network", Mean: 20, Spread: 5}}
+	cfg.Noise = NoiseConfig{Distribution: NormalNoise, Spread: 0.3, Correlation: 0.5}
+	executions := s.assertReplays(cfg, 20)
+	s.True(slices.ContainsFunc(executions, func(e *Execution) bool { return e.usage["network"] != e.query.usage["network"] }))
+}
+
+func (s *TestSuite) TestTraceReplaysMaintenance() {
+	cfg := DefaultConfig()
+	cfg.Seed = 9
+	cfg.Maintenance.Rate = 0.3
+	executions := s.assertReplays(cfg, 30)
+	s.True(slices.ContainsFunc(executions, func(e *Execution) bool { return e.kind == KindMaintenance && e.finishBy > 0 }))
+}
+
+func (s *TestSuite) TestTraceReplaysChurn() {
+	cfg := DefaultConfig()
+	cfg.Seed = 11
+	cfg.Queries = 5
+	cfg.Churn = ChurnConfig{DriftRate: 0.3, DriftSize: 0.5, IntroduceRate: 0.3}
+	executions := s.assertReplays(cfg, 40)
+
+	// Some arrivals are of templates introduced during the run, which the trace recorded as well
+	catalog, _, _, err := loadQueries(cfg)
+	s.Require().NoError(err)
+	introduced := func(e *Execution) bool {
+		return !slices.ContainsFunc(catalog, func(query *Query) bool { return query.id == e.query.id })
+	}
+	s.True(slices.ContainsFunc(executions, introduced))
+}
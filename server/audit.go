@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// auditRetention is the number of audit entries kept in memory to be queried
+const auditRetention = 10000
+
+// Audited actions
+const (
+	AuditDelay = "delay"
+	AuditRoute = "route"
+	AuditCurve = "curve"
+)
+
+// AuditEntry records a mutating request that reached a database, whether it succeeded or was refused
+type AuditEntry struct {
+	ID        int    `json:"id"` // ID increases with every entry, so clients can poll for new ones with ?since=
+	Timestamp int64  `json:"timestamp"`
+	Database  string `json:"database"`
+	Actor     string `json:"actor,omitempty"`  // Actor is who made the request, as given by the caller
+	Reason    string `json:"reason,omitempty"` // Reason is why the request was made, as given by the caller
+	Action    string `json:"action"`
+	Execution string `json:"execution,omitempty"`
+	Delay     int    `json:"delay,omitempty"`
+	Node      string `json:"node,omitempty"`
+	Curve     string `json:"curve,omitempty"`
+	Before    *int   `json:"before,omitempty"` // Before is the tick the execution was due on before the action, if it was queued
+	After     *int   `json:"after,omitempty"`  // After is the tick the execution is due on after the action, if it is still queued
+	Status    int    `json:"status"`           // Status is the HTTP status of the response
+	Result    string `json:"result"`
+}
+
+// AuditFilter selects audit entries. Empty fields match every entry.
+type AuditFilter struct {
+	Database  string
+	Actor     string
+	Action    string
+	Execution string
+	Since     int // Since only matches entries with a greater ID
+	Limit     int // Limit keeps the most recent entries that match, 0 for all
+}
+
+func (f AuditFilter) matches(entry AuditEntry) bool {
+	return entry.ID > f.Since &&
+		(f.Database == "" || entry.Database == f.Database) &&
+		(f.Actor == "" || entry.Actor == f.Actor) &&
+		(f.Action == "" || entry.Action == f.Action) &&
+		(f.Execution == "" || entry.Execution == f.Execution)
+}
+
+// auditLog is an append-only log of the mutating requests. Every entry is appended to the file as
+// a line of JSON, if one is set, and the most recent are kept in memory to be queried.
+type auditLog struct {
+	mu        sync.Mutex
+	entries   []AuditEntry
+	retention int
+	nextID    int
+	file      *os.File
+}
+
+func newAuditLog(retention int) *auditLog {
+	return &auditLog{retention: retention, nextID: 1}
+}
+
+// openAuditFile appends every entry to the file at path from now on. IDs continue from the
+// greatest already in the file, so they do not repeat across restarts.
+func (a *auditLog) openAuditFile(path string) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// A line cut short by a crash is skipped rather than failing startup
+		var entry AuditEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil && entry.ID >= a.nextID {
+			a.nextID = entry.ID + 1
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return err
+	}
+	a.file = file
+	return nil
+}
+
+// append records an entry, giving it the next ID and the current time
+func (a *auditLog) append(entry AuditEntry) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	entry.ID = a.nextID
+	entry.Timestamp = time.Now().UnixMilli()
+	a.nextID++
+	a.entries = append(a.entries, entry)
+	if len(a.entries) > a.retention {
+		a.entries = a.entries[len(a.entries)-a.retention:]
+	}
+	if a.file == nil {
+		return nil
+	}
+	return json.NewEncoder(a.file).Encode(entry)
+}
+
+// query returns the entries kept in memory that match the filter, oldest first
+func (a *auditLog) query(filter AuditFilter) []AuditEntry {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	matched := make([]AuditEntry, 0)
+	for _, entry := range a.entries {
+		if filter.matches(entry) {
+			matched = append(matched, entry)
+		}
+	}
+	if filter.Limit > 0 && len(matched) > filter.Limit {
+		matched = matched[len(matched)-filter.Limit:]
+	}
+	return matched
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"alertwest-interview-q1/lib"
+)
+
+// auditIDs returns the IDs of the entries, in order
+func auditIDs(entries []AuditEntry) []int {
+	ids := make([]int, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.ID
+	}
+	return ids
+}
+
+func (s *TestSuite) TestAuditRetention() {
+	audit := newAuditLog(3)
+	for i := 0; i < 5; i++ {
+		s.NoError(audit.append(AuditEntry{Database: DefaultDatabase, Action: AuditDelay}))
+	}
+
+	// Only the most recent entries are kept, and IDs keep increasing past the trimmed ones
+	entries := audit.query(AuditFilter{})
+	s.Equal([]int{3, 4, 5}, auditIDs(entries))
+	for _, entry := range entries {
+		s.Positive(entry.Timestamp)
+	}
+}
+
+func (s *TestSuite) TestAuditQuery() {
+	audit := newAuditLog(auditRetention)
+	for _, entry := range []AuditEntry{
+		{Database: "orders", Actor: "alice", Action: AuditDelay, Execution: "a"},
+		{Database: "orders", Actor: "bob", Action: AuditRoute, Execution: "b"},
+		{Database: "billing", Actor: "alice", Action: AuditCurve},
+		{Database: "orders", Actor: "alice", Action: AuditDelay, Execution: "b"},
+	} {
+		s.NoError(audit.append(entry))
+	}
+
+	s.Equal([]int{1, 2, 3, 4}, auditIDs(audit.query(AuditFilter{})))
+	s.Equal([]int{1, 2, 4}, auditIDs(audit.query(AuditFilter{Database: "orders"})))
+	s.Equal([]int{1, 3, 4}, auditIDs(audit.query(AuditFilter{Actor: "alice"})))
+	s.Equal([]int{1, 4}, auditIDs(audit.query(AuditFilter{Action: AuditDelay})))
+	s.Equal([]int{2, 4}, auditIDs(audit.query(AuditFilter{Execution: "b"})))
+	s.Equal([]int{3, 4}, auditIDs(audit.query(AuditFilter{Since: 2})))
+	s.Equal([]int{3, 4}, auditIDs(audit.query(AuditFilter{Limit: 2})))
+	s.Equal([]int{4}, auditIDs(audit.query(AuditFilter{Actor: "alice", Since: 1, Limit: 1})))
+	s.Empty(audit.query(AuditFilter{Database: "inventory"}))
+	s.Empty(audit.query(AuditFilter{Since: 4}))
+}
+
+func (s *TestSuite) TestAuditFile() {
+	path := filepath.Join(s.T().TempDir(), "audit.jsonl")
+	audit := newAuditLog(1)
+	s.NoError(audit.openAuditFile(path))
+	s.NoError(audit.append(AuditEntry{Database: DefaultDatabase, Action: AuditDelay, Status: 200}))
+	s.NoError(audit.append(AuditEntry{Database: DefaultDatabase, Action: AuditRoute, Status: 404}))
+	audit.file.Close()
+
+	// The file keeps every entry, even those trimmed from memory
+	file, err := os.Open(path)
+	s.Require().NoError(err)
+	defer file.Close()
+	var written []AuditEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry AuditEntry
+		s.NoError(json.Unmarshal(scanner.Bytes(), &entry))
+		written = append(written, entry)
+	}
+	s.Equal([]int{1, 2}, auditIDs(written))
+	s.Equal(AuditRoute, written[1].Action)
+	s.Len(audit.query(AuditFilter{}), 1)
+}
+
+func (s *TestSuite) TestAuditCurveRequest() {
+	server := NewServer([]Database{{Name: DefaultDatabase, DB: lib.NewDB()}})
+	body := `{"name": "constant", "level": 2, "actor": "oncall", "reason": "load test"}`
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/admin/curve", strings.NewReader(body)))
+	s.Equal(http.StatusOK, recorder.Code)
+
+	entries := server.audit.query(AuditFilter{Action: AuditCurve})
+	s.Require().Len(entries, 1)
+	s.Equal("oncall", entries[0].Actor)
+	s.Equal("load test", entries[0].Reason)
+	s.Equal(lib.ConstantCurve, entries[0].Curve)
+	s.Equal(lib.CurveConfig{Name: lib.ConstantCurve, Level: 2}, server.dbs[DefaultDatabase].GetLoadCurve())
+
+	// The actor and reason sit next to the fields of the curve, which still rejects unknown ones
+	var request CurveRequest
+	s.NoError(json.Unmarshal([]byte(body), &request))
+	data, err := json.Marshal(request)
+	s.NoError(err)
+	s.JSONEq(body, string(data))
+	s.Error(json.Unmarshal([]byte(`{"name": "constant", "levle": 2}`), &request))
+}
+
+func (s *TestSuite) TestAuditFileRestart() {
+	path := filepath.Join(s.T().TempDir(), "audit.jsonl")
+	audit := newAuditLog(auditRetention)
+	s.NoError(audit.openAuditFile(path))
+	s.NoError(audit.append(AuditEntry{Database: DefaultDatabase, Action: AuditDelay}))
+	s.NoError(audit.append(AuditEntry{Database: DefaultDatabase, Action: AuditDelay}))
+	audit.file.Close()
+
+	// A restarted server appending to the same file carries on from the last ID
+	audit = newAuditLog(auditRetention)
+	s.NoError(audit.openAuditFile(path))
+	s.NoError(audit.append(AuditEntry{Database: DefaultDatabase, Action: AuditRoute}))
+	audit.file.Close()
+	s.Equal([]int{3}, auditIDs(audit.query(AuditFilter{})))
+}
+
+func (s *TestSuite) TestAuditRejectedRequests() {
+	server := NewServer([]Database{{Name: DefaultDatabase, DB: lib.NewDB()}})
+	for _, request := range []struct{ target, body string }{
+		{"/delay", `not json`},
+		{"/delay", `{"delay": 5, "actor": "oncall"}`},
+		{"/route", `{"node": "primary"}`},
+		{"/admin/curve", `{"name": "constant", "levle": 2}`},
+	} {
+		s.Equal(http.StatusBadRequest, post(server, request.target, request.body).Code, request.target)
+	}
+
+	entries := server.audit.query(AuditFilter{})
+	s.Require().Len(entries, 4)
+	for _, entry := range entries {
+		s.Equal(DefaultDatabase, entry.Database)
+		s.Equal(http.StatusBadRequest, entry.Status)
+	}
+	s.Equal(AuditDelay, entries[0].Action)
+	s.Equal("Invalid request body", entries[0].Result)
+	s.Equal("oncall", entries[1].Actor)
+	s.Equal(5, entries[1].Delay)
+	s.Equal("Missing execution ID", entries[1].Result)
+	s.Equal(AuditRoute, entries[2].Action)
+	s.Equal(AuditCurve, entries[3].Action)
+}
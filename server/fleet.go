@@ -0,0 +1,126 @@
+package main
+
+import (
+	"alertwest-interview-q1/lib"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// DefaultDatabase is the name of the database hosted when no fleet is configured
+const DefaultDatabase = "default"
+
+// FleetConfig lists the databases the server hosts, each with its own config
+type FleetConfig struct {
+	Databases []FleetDatabase `json:"databases"`
+}
+
+// FleetDatabase is a database of the fleet
+type FleetDatabase struct {
+	Name   string `json:"name"`   // Name is the name the database is served under at /db/{name}
+	Config string `json:"config"` // Config is the JSON config file of the database, the defaults if omitted
+	Seed   int64  `json:"seed"`   // Seed overrides the seed of the config, if set
+}
+
+// Database is a database hosted by the server under its name
+type Database struct {
+	Name string
+	DB   *lib.DB
+}
+
+var databaseName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// LoadFleet reads a JSON fleet config file
+func LoadFleet(path string) (FleetConfig, error) {
+	var fleet FleetConfig
+	file, err := os.Open(path)
+	if err != nil {
+		return fleet, err
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&fleet); err != nil {
+		return fleet, fmt.Errorf("invalid fleet %s: %w", path, err)
+	}
+	return fleet, fleet.validate()
+}
+
+func (f FleetConfig) validate() error {
+	if len(f.Databases) == 0 {
+		return fmt.Errorf("fleet needs at least one database")
+	}
+	seen := make(map[string]bool, len(f.Databases))
+	for _, database := range f.Databases {
+		if !databaseName.MatchString(database.Name) || seen[database.Name] {
+			return fmt.Errorf("fleet databases need a unique name of letters, digits, - and _")
+		}
+		seen[database.Name] = true
+	}
+
+	// Databases writing to the same file would interleave or truncate each other's output
+	writers := make(map[string]string)
+	for _, database := range f.Databases {
+		cfg, err := database.config()
+		if err != nil {
+			return err
+		}
+		for _, path := range outputs(cfg) {
+			abs, err := filepath.Abs(path)
+			if err != nil {
+				return fmt.Errorf("database %s: %w", database.Name, err)
+			}
+			if writer, ok := writers[abs]; ok {
+				return fmt.Errorf("databases %s and %s both write to %s", writer, database.Name, path)
+			}
+			writers[abs] = database.Name
+		}
+	}
+	return nil
+}
+
+// config loads the config of the database, with its seed override applied
+func (d FleetDatabase) config() (lib.Config, error) {
+	cfg := lib.DefaultConfig()
+	if d.Config != "" {
+		var err error
+		if cfg, err = lib.LoadConfig(d.Config); err != nil {
+			return cfg, fmt.Errorf("database %s: %w", d.Name, err)
+		}
+	}
+	if d.Seed != 0 {
+		cfg.Seed = d.Seed
+	}
+	return cfg, nil
+}
+
+// outputs returns the files a database with the config writes to
+func outputs(cfg lib.Config) []string {
+	var paths []string
+	for _, path := range []string{cfg.Trace.Record, cfg.Noise.Log, cfg.Churn.Log, cfg.ExportCatalog} {
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// open creates every database of the fleet, in order
+func (f FleetConfig) open() ([]Database, error) {
+	databases := make([]Database, 0, len(f.Databases))
+	for _, database := range f.Databases {
+		cfg, err := database.config()
+		if err != nil {
+			return nil, err
+		}
+		db, err := lib.NewDBWithConfig(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("database %s: %w", database.Name, err)
+		}
+		databases = append(databases, Database{Name: database.Name, DB: db})
+	}
+	return databases, nil
+}
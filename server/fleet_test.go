@@ -0,0 +1,30 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+func (s *TestSuite) TestFleetNames() {
+	s.Error(FleetConfig{}.validate())
+	s.Error(FleetConfig{Databases: []FleetDatabase{{Name: "orders"}, {Name: "orders"}}}.validate())
+	s.Error(FleetConfig{Databases: []FleetDatabase{{Name: "orders/eu"}}}.validate())
+	s.NoError(FleetConfig{Databases: []FleetDatabase{{Name: "orders"}, {Name: "billing"}}}.validate())
+}
+
+func (s *TestSuite) TestFleetOutputs() {
+	dir := s.T().TempDir()
+	config := func(name, body string) string {
+		path := filepath.Join(dir, name)
+		s.Require().NoError(os.WriteFile(path, []byte(body), 0644))
+		return path
+	}
+	orders := config("orders.json", `{"trace": {"record": "trace.ndjson"}}`)
+	billing := config("billing.json", `{"noise": {"log": "trace.ndjson"}}`)
+	analytics := config("analytics.json", `{"trace": {"record": "analytics.ndjson"}, "export_catalog": "analytics.csv"}`)
+
+	// Two databases writing the same file would clobber each other's output
+	err := FleetConfig{Databases: []FleetDatabase{{Name: "orders", Config: orders}, {Name: "billing", Config: billing}}}.validate()
+	s.ErrorContains(err, "databases orders and billing both write to trace.ndjson")
+	s.NoError(FleetConfig{Databases: []FleetDatabase{{Name: "orders", Config: orders}, {Name: "analytics", Config: analytics}}}.validate())
+}
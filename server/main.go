@@ -1,7 +1,6 @@
 package main
 
 import (
-	"alertwest-interview-q1/lib"
 	"os"
 
 	"github.com/rs/zerolog"
@@ -11,10 +10,32 @@ import (
 func main() {
 	zerolog.SetGlobalLevel(zerolog.InfoLevel)
 	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
-	db := lib.NewDB()
-	server := NewServer(db)
+
+	// Host the databases listed in DB_FLEET, or a single one with the config in DB_CONFIG
+	fleet := FleetConfig{Databases: []FleetDatabase{{Name: DefaultDatabase, Config: os.Getenv("DB_CONFIG")}}}
+	if path := os.Getenv("DB_FLEET"); path != "" {
+		var err error
+		fleet, err = LoadFleet(path)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to load fleet")
+		}
+	}
+
+	databases, err := fleet.open()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to create database")
+	}
+	server := NewServer(databases)
+	if path := os.Getenv("AUDIT_LOG"); path != "" {
+		if err := server.audit.openAuditFile(path); err != nil {
+			log.Fatal().Err(err).Msg("Failed to open audit log")
+		}
+	}
 
 	// Start components
-	db.Run()
+	for _, database := range databases {
+		database.DB.Run()
+		log.Info().Str("Database", database.Name).Msg("Database started")
+	}
 	server.Start(":8080")
 }
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"alertwest-interview-q1/lib"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// writeResourceMetrics writes the usage of every resource over the last metrics interval as gauges, labelled with the resource and statistic, and with the tenant if tenants are configured
+func writeResourceMetrics(w io.Writer, metrics *lib.ResourceMetrics) {
+	fmt.Fprintln(w, "# HELP db_resource_usage Resource usage per tick over the last metrics interval.")
+	fmt.Fprintln(w, "# TYPE db_resource_usage gauge")
+	for _, name := range metrics.Dimensions() {
+		usage := metrics.Resources[name]
+		fmt.Fprintf(w, "db_resource_usage{resource=%q,stat=\"average\"} %d\n", name, usage.Average)
+		fmt.Fprintf(w, "db_resource_usage{resource=%q,stat=\"min\"} %d\n", name, usage.Min)
+		fmt.Fprintf(w, "db_resource_usage{resource=%q,stat=\"max\"} %d\n", name, usage.Max)
+	}
+	if metrics.Tenants == nil {
+		return
+	}
+
+	tenants := make([]string, 0, len(metrics.Tenants))
+	for tenant := range metrics.Tenants {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+	fmt.Fprintln(w, "# HELP db_tenant_resource_usage Resource usage per tick of each tenant over the last metrics interval.")
+	fmt.Fprintln(w, "# TYPE db_tenant_resource_usage gauge")
+	for _, tenant := range tenants {
+		for _, name := range metrics.Dimensions() {
+			usage := metrics.Tenants[tenant][name]
+			fmt.Fprintf(w, "db_tenant_resource_usage{tenant=%q,resource=%q,stat=\"average\"} %d\n", tenant, name, usage.Average)
+			fmt.Fprintf(w, "db_tenant_resource_usage{tenant=%q,resource=%q,stat=\"min\"} %d\n", tenant, name, usage.Min)
+			fmt.Fprintf(w, "db_tenant_resource_usage{tenant=%q,resource=%q,stat=\"max\"} %d\n", tenant, name, usage.Max)
+		}
+	}
+}
+
+// writeNodeMetrics writes the usage of every resource on each node of the cluster as gauges, labelled with the node, resource and statistic
+func writeNodeMetrics(w io.Writer, nodes []lib.NodeMetrics) {
+	if nodes == nil {
+		return
+	}
+	fmt.Fprintln(w, "# HELP db_node_resource_usage Resource usage per tick of each cluster node over the last metrics interval.")
+	fmt.Fprintln(w, "# TYPE db_node_resource_usage gauge")
+	for _, node := range nodes {
+		for _, name := range node.Resources.Dimensions() {
+			usage := node.Resources.Resources[name]
+			fmt.Fprintf(w, "db_node_resource_usage{node=%q,resource=%q,stat=\"average\"} %d\n", node.Name, name, usage.Average)
+			fmt.Fprintf(w, "db_node_resource_usage{node=%q,resource=%q,stat=\"min\"} %d\n", node.Name, name, usage.Min)
+			fmt.Fprintf(w, "db_node_resource_usage{node=%q,resource=%q,stat=\"max\"} %d\n", node.Name, name, usage.Max)
+		}
+	}
+}
+
+// writeQueueMetrics writes the depth of the queue and the actions it took on executions over the last metrics interval as gauges
+func writeQueueMetrics(w io.Writer, metrics *lib.ResourceMetrics) {
+	fmt.Fprintln(w, "# HELP db_queue_depth Executions queued at the end of each tick over the last metrics interval.")
+	fmt.Fprintln(w, "# TYPE db_queue_depth gauge")
+	fmt.Fprintf(w, "db_queue_depth{stat=\"average\"} %d\n", metrics.Depth.Average)
+	fmt.Fprintf(w, "db_queue_depth{stat=\"min\"} %d\n", metrics.Depth.Min)
+	fmt.Fprintf(w, "db_queue_depth{stat=\"max\"} %d\n", metrics.Depth.Max)
+
+	actions := []struct {
+		name  string
+		count int
+	}{
+		{"carried", metrics.Queue.Carried},
+		{"expired", metrics.Queue.Expired},
+		{"forced", metrics.Queue.ForcedRun},
+		{"dropped", metrics.Queue.Dropped},
+		{"evicted", metrics.Queue.Evicted},
+		{"overflow", metrics.Queue.Overflow},
+	}
+	fmt.Fprintln(w, "# HELP db_queue_actions Actions the queue took on executions over the last metrics interval.")
+	fmt.Fprintln(w, "# TYPE db_queue_actions gauge")
+	for _, action := range actions {
+		fmt.Fprintf(w, "db_queue_actions{action=%q} %d\n", action.name, action.count)
+	}
+}
+
+// writeCacheMetrics writes the query result cache lookups since startup as counters
+func writeCacheMetrics(w io.Writer, stats lib.CacheStats) {
+	counters := []struct {
+		name  string
+		help  string
+		value int
+	}{
+		{"db_cache_hits_total", "Executions whose query result was cached.", stats.Hits},
+		{"db_cache_misses_total", "Executions whose query result was not cached.", stats.Misses},
+		{"db_cache_evictions_total", "Query results evicted to make room in the cache.", stats.Evictions},
+	}
+	for _, counter := range counters {
+		fmt.Fprintf(w, "# HELP %s %s\n", counter.name, counter.help)
+		fmt.Fprintf(w, "# TYPE %s counter\n", counter.name)
+		fmt.Fprintf(w, "%s %d\n", counter.name, counter.value)
+	}
+}
+
+// writeLatencyMetrics writes the queue latency as Prometheus histograms, overall, per query template and per tenant
+func writeLatencyMetrics(w io.Writer, latency *lib.LatencyMetrics) {
+	fmt.Fprintln(w, "# HELP db_queue_latency_seconds Time from enqueue to execution of all queries.")
+	fmt.Fprintln(w, "# TYPE db_queue_latency_seconds histogram")
+	writeLatencyReport(w, "db_queue_latency_seconds", "", latency.Overall)
+
+	fmt.Fprintln(w, "# HELP db_query_queue_latency_seconds Time from enqueue to execution per query template.")
+	fmt.Fprintln(w, "# TYPE db_query_queue_latency_seconds histogram")
+	for _, report := range latency.Queries {
+		writeLatencyReport(w, "db_query_queue_latency_seconds", fmt.Sprintf("query=%q,", report.Query), report)
+	}
+	if len(latency.Tenants) == 0 {
+		return
+	}
+
+	fmt.Fprintln(w, "# HELP db_tenant_queue_latency_seconds Time from enqueue to execution per tenant.")
+	fmt.Fprintln(w, "# TYPE db_tenant_queue_latency_seconds histogram")
+	for _, report := range latency.Tenants {
+		writeLatencyReport(w, "db_tenant_queue_latency_seconds", fmt.Sprintf("tenant=%q,", report.Tenant), report)
+	}
+}
+
+// writeLatencyReport writes one histogram per latency component, labelled with the component name
+func writeLatencyReport(w io.Writer, name string, labels string, report lib.LatencyReport) {
+	components := []struct {
+		name  string
+		stats lib.LatencyStats
+	}{{"total", report.Total}, {"default", report.Default}, {"added", report.Added}, {"stretch", report.Stretch}}
+
+	for _, component := range components {
+		componentLabels := fmt.Sprintf("%scomponent=%q", labels, component.name)
+		for _, bucket := range component.stats.Buckets {
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"%g\"} %d\n", name, componentLabels, float64(bucket.UpperBound)/1000, bucket.Count)
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, componentLabels, component.stats.Count)
+		fmt.Fprintf(w, "%s_sum{%s} %g\n", name, componentLabels, float64(component.stats.Sum)/1000)
+		fmt.Fprintf(w, "%s_count{%s} %d\n", name, componentLabels, component.stats.Count)
+	}
+}
@@ -3,7 +3,9 @@ package main
 import (
 	"alertwest-interview-q1/lib"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
@@ -11,31 +13,132 @@ import (
 
 // DelayRequest represents a request to delay a query execution
 type DelayRequest struct {
-	ID    uuid.UUID `json:"id"`
-	Delay int       `json:"delay"`
+	ID     uuid.UUID `json:"id"`
+	Delay  int       `json:"delay"`
+	Actor  string    `json:"actor,omitempty"`  // Actor is who makes the request, recorded in the audit log
+	Reason string    `json:"reason,omitempty"` // Reason is why the request is made, recorded in the audit log
+}
+
+// RouteRequest represents a request to move a query execution to another node of the cluster
+type RouteRequest struct {
+	ID     uuid.UUID `json:"id"`
+	Node   string    `json:"node"`
+	Actor  string    `json:"actor,omitempty"`  // Actor is who makes the request, recorded in the audit log
+	Reason string    `json:"reason,omitempty"` // Reason is why the request is made, recorded in the audit log
+}
+
+// CurveRequest represents a request to replace the load curve. The fields of the curve are at the
+// top level of the body, next to the actor and reason.
+type CurveRequest struct {
+	lib.CurveConfig
+	Actor  string `json:"actor,omitempty"`  // Actor is who makes the request, recorded in the audit log
+	Reason string `json:"reason,omitempty"` // Reason is why the request is made, recorded in the audit log
+}
+
+// UnmarshalJSON takes the actor and reason out of the body and decodes the rest as the curve, which
+// would otherwise decode the whole body and reject them as unknown fields
+func (c *CurveRequest) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for name, field := range map[string]*string{"actor": &c.Actor, "reason": &c.Reason} {
+		if raw, ok := fields[name]; ok {
+			if err := json.Unmarshal(raw, field); err != nil {
+				return err
+			}
+			delete(fields, name)
+		}
+	}
+	curve, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(curve, &c.CurveConfig)
+}
+
+// MarshalJSON writes the curve with the actor and reason next to its fields
+func (c CurveRequest) MarshalJSON() ([]byte, error) {
+	curve, err := json.Marshal(c.CurveConfig)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(curve, &fields); err != nil {
+		return nil, err
+	}
+	for name, value := range map[string]string{"actor": c.Actor, "reason": c.Reason} {
+		if value != "" {
+			fields[name], _ = json.Marshal(value)
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// DatabaseSummary is an entry of the GET /db listing
+type DatabaseSummary struct {
+	Name   string `json:"name"`
+	Queued int    `json:"queued"` // Queued is the number of executions currently queued
 }
 
 // Server represents the HTTP server
 type Server struct {
-	mux *http.ServeMux
-	db  *lib.DB
+	mux       *http.ServeMux
+	databases []Database
+	dbs       map[string]*lib.DB
+	audit     *auditLog // audit records the mutating requests of every database
 }
 
-// NewServer creates a new HTTP server
-func NewServer(db *lib.DB) *Server {
+// NewServer creates a new HTTP server hosting the databases. The unprefixed routes serve the first
+// database, and every database is served under /db/{name}.
+func NewServer(databases []Database) *Server {
 	server := &Server{
-		mux: http.NewServeMux(),
-		db:  db,
+		mux:       http.NewServeMux(),
+		databases: databases,
+		dbs:       make(map[string]*lib.DB, len(databases)),
+		audit:     newAuditLog(auditRetention),
+	}
+	for _, database := range databases {
+		server.dbs[database.Name] = database.DB
 	}
 
 	// Set up routes
-	server.mux.HandleFunc("/queued", server.handleGetQueued)
-	server.mux.HandleFunc("/resources", server.handleGetResources)
-	server.mux.HandleFunc("/delay", server.handlePostDelay)
+	server.mux.HandleFunc("/db", server.handleGetDatabases)
+	server.mux.HandleFunc("/audit", server.handleGetAudit)
+	server.handle("/queued", server.handleGetQueued)
+	server.handle("/resources", server.handleGetResources)
+	server.handle("/delay", server.handlePostDelay)
+	server.handle("/latency", server.handleGetLatency)
+	server.handle("/metrics", server.handleGetMetrics)
+	server.handle("/admin/curve", server.handleAdminCurve)
+	server.handle("/catalog", server.handleGetCatalog)
+	server.handle("/nodes", server.handleGetNodes)
+	server.handle("/route", server.handlePostRoute)
+	server.handle("/executions/{id}", server.handleGetExecution)
 
 	return server
 }
 
+// handle registers the handler on the path for the first database, and under /db/{name} for every database
+func (s *Server) handle(path string, handler http.HandlerFunc) {
+	s.mux.HandleFunc(path, handler)
+	s.mux.HandleFunc("/db/{name}"+path, handler)
+}
+
+// db returns the database named in the request path, or the first database for the unprefixed
+// routes. It responds with 404 Not Found if there is no such database.
+func (s *Server) db(w http.ResponseWriter, r *http.Request) (*lib.DB, bool) {
+	name := r.PathValue("name")
+	if name == "" {
+		return s.databases[0].DB, true
+	}
+	db, ok := s.dbs[name]
+	if !ok {
+		http.Error(w, "Database not found", http.StatusNotFound)
+	}
+	return db, ok
+}
+
 func (s *Server) Start(addr string) {
 	log.Info().Str("Listening on", addr).Msg("Starting server")
 	http.ListenAndServe(addr, s)
@@ -46,8 +149,90 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	s.mux.ServeHTTP(w, r)
 }
 
+// dbName returns the name of the database a request is for
+func (s *Server) dbName(r *http.Request) string {
+	if name := r.PathValue("name"); name != "" {
+		return name
+	}
+	return s.databases[0].Name
+}
+
+// record appends a mutating request to the audit log with its outcome
+func (s *Server) record(entry AuditEntry, status int, result string) {
+	entry.Status = status
+	entry.Result = result
+	if entry.Result == "" {
+		entry.Result = http.StatusText(status)
+	}
+	if err := s.audit.append(entry); err != nil {
+		log.Err(err).Msg("Failed to write audit log")
+	}
+}
+
+// respond records a mutating request in the audit log, then responds with its status, and with
+// the message as the error for a failure
+func (s *Server) respond(w http.ResponseWriter, entry AuditEntry, status int, message string) {
+	s.record(entry, status, message)
+	if status != http.StatusOK {
+		http.Error(w, message, status)
+		return
+	}
+	w.WriteHeader(status)
+}
+
+// handleGetAudit handles GET /audit requests
+// This returns the audit log, oldest first, filtered with ?db=, ?actor=, ?action=, ?execution=, ?since= and ?limit=.
+func (s *Server) handleGetAudit(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET requests
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := AuditFilter{
+		Database:  query.Get("db"),
+		Actor:     query.Get("actor"),
+		Action:    query.Get("action"),
+		Execution: query.Get("execution"),
+	}
+	for name, value := range map[string]*int{"since": &filter.Since, "limit": &filter.Limit} {
+		if raw := query.Get(name); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 0 {
+				http.Error(w, "Invalid "+name, http.StatusBadRequest)
+				return
+			}
+			*value = n
+		}
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.audit.query(filter))
+}
+
+// handleGetDatabases handles GET /db requests
+// This returns the hosted databases in the order they were configured.
+func (s *Server) handleGetDatabases(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET requests
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	summaries := make([]DatabaseSummary, 0, len(s.databases))
+	for _, database := range s.databases {
+		summaries = append(summaries, DatabaseSummary{Name: database.Name, Queued: database.DB.Depth()})
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summaries)
+}
+
 // handleGetQueued handles GET /queued requests - currently polled every 5s on the client side.
-// This returns the current list of queued (but not yet executed) queries.
+// This returns the current list of queued (but not yet executed) queries, only those of one tenant with ?tenant=.
 func (s *Server) handleGetQueued(w http.ResponseWriter, r *http.Request) {
 	// Only allow GET requests
 	if r.Method != http.MethodGet {
@@ -55,22 +240,31 @@ func (s *Server) handleGetQueued(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Send request through the channel
-	queued := s.db.GetQueued()
-
-	if len(queued) == 0 {
-		w.WriteHeader(http.StatusNoContent)
+	db, ok := s.db(w, r)
+	if !ok {
 		return
 	}
 
+	// Send request through the channel
+	queued := db.GetQueued()
+	tenant := r.URL.Query().Get("tenant")
+
 	// Create response array
 	responses := make([]lib.QueuedOperation, 0, len(queued))
 
 	// Process each queued query
 	for _, query := range queued {
+		if tenant != "" && query.Execution.Tenant != tenant {
+			continue
+		}
 		responses = append(responses, *query)
 	}
 
+	if len(responses) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
 	// Send response
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(responses)
@@ -84,14 +278,62 @@ func (s *Server) handleGetResources(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	db, ok := s.db(w, r)
+	if !ok {
+		return
+	}
+
 	// Send request through the channel
-	metrics := s.db.GetResources()
+	metrics := db.GetResources()
 
 	// Send response
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(metrics)
 }
 
+// handleGetLatency handles GET /latency requests
+// This returns the queue latency percentiles of executed queries, per query template and overall.
+func (s *Server) handleGetLatency(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET requests
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	db, ok := s.db(w, r)
+	if !ok {
+		return
+	}
+
+	latency := db.GetLatency()
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(latency)
+}
+
+// handleGetMetrics handles GET /metrics requests in the Prometheus text exposition format
+func (s *Server) handleGetMetrics(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET requests
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	db, ok := s.db(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	resources := db.GetResources()
+	writeResourceMetrics(w, resources)
+	writeQueueMetrics(w, resources)
+	writeCacheMetrics(w, db.GetCacheStats())
+	writeLatencyMetrics(w, db.GetLatency())
+	writeNodeMetrics(w, db.GetNodes())
+}
+
 // handlePostDelay handles POST /delay requests
 func (s *Server) handlePostDelay(w http.ResponseWriter, r *http.Request) {
 	// Only allow POST requests
@@ -100,24 +342,225 @@ func (s *Server) handlePostDelay(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	db, ok := s.db(w, r)
+	if !ok {
+		return
+	}
+
+	// Rejected requests are audited too, with whatever of the body could be read
 	var request DelayRequest
-	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	err := json.NewDecoder(r.Body).Decode(&request)
+	entry := AuditEntry{
+		Database: s.dbName(r),
+		Actor:    request.Actor,
+		Reason:   request.Reason,
+		Action:   AuditDelay,
+		Delay:    request.Delay,
+	}
+	if err != nil {
+		s.respond(w, entry, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
 	// Validate request
 	if request.ID == uuid.Nil {
-		http.Error(w, "Missing execution ID", http.StatusBadRequest)
+		s.respond(w, entry, http.StatusBadRequest, "Missing execution ID")
 		return
 	}
 
-	// Send request through the channel
-	err := s.db.Delay(request.ID, request.Delay)
+	entry.Execution = request.ID.String()
+	schedule, err := db.DelayWithSchedule(request.ID, request.Delay)
+	entry.Before, entry.After = schedule.Before, schedule.After
+
+	switch {
+	case errors.Is(err, lib.ErrNegativeDelay):
+		s.respond(w, entry, http.StatusBadRequest, err.Error())
+	case errors.Is(err, lib.ErrExecutionNotFound):
+		s.respond(w, entry, http.StatusNotFound, "Execution not found")
+	case errors.Is(err, lib.ErrDelayCeiling) || errors.Is(err, lib.ErrDeadlineExceeded) || errors.Is(err, lib.ErrTenantQuota):
+		s.respond(w, entry, http.StatusConflict, err.Error())
+	case err != nil:
+		s.respond(w, entry, http.StatusInternalServerError, "Failed to delay query")
+	default:
+		s.respond(w, entry, http.StatusOK, "")
+	}
+}
+
+// handleGetNodes handles GET /nodes requests
+// This returns the resource utilization of every node of the cluster, or no content without a cluster.
+func (s *Server) handleGetNodes(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET requests
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	db, ok := s.db(w, r)
+	if !ok {
+		return
+	}
+
+	nodes := db.GetNodes()
+	if nodes == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(nodes)
+}
+
+// handlePostRoute handles POST /route requests
+func (s *Server) handlePostRoute(w http.ResponseWriter, r *http.Request) {
+	// Only allow POST requests
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	db, ok := s.db(w, r)
+	if !ok {
+		return
+	}
+
+	// Rejected requests are audited too, with whatever of the body could be read
+	var request RouteRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	entry := AuditEntry{
+		Database: s.dbName(r),
+		Actor:    request.Actor,
+		Reason:   request.Reason,
+		Action:   AuditRoute,
+		Node:     request.Node,
+	}
 	if err != nil {
-		http.Error(w, "Failed to delay query", http.StatusInternalServerError)
+		s.respond(w, entry, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	// Validate request
+	if request.ID == uuid.Nil {
+		s.respond(w, entry, http.StatusBadRequest, "Missing execution ID")
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	entry.Execution = request.ID.String()
+	schedule, err := db.RouteWithSchedule(request.ID, request.Node)
+	entry.Before, entry.After = schedule.Before, schedule.After
+
+	switch {
+	case errors.Is(err, lib.ErrExecutionNotFound):
+		s.respond(w, entry, http.StatusNotFound, "Execution not found")
+	case errors.Is(err, lib.ErrNodeNotFound):
+		s.respond(w, entry, http.StatusNotFound, "Node not found")
+	case errors.Is(err, lib.ErrWriteOnReplica):
+		s.respond(w, entry, http.StatusConflict, err.Error())
+	case err != nil:
+		s.respond(w, entry, http.StatusInternalServerError, "Failed to route query")
+	default:
+		s.respond(w, entry, http.StatusOK, "")
+	}
+}
+
+// handleGetExecution handles GET /executions/{id} requests
+// This returns the transitions of a recent execution, from its arrival to its current state.
+func (s *Server) handleGetExecution(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET requests
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	db, ok := s.db(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid execution ID", http.StatusBadRequest)
+		return
+	}
+	history, err := db.GetExecution(id)
+	if errors.Is(err, lib.ErrExecutionNotFound) {
+		http.Error(w, "Execution not found", http.StatusNotFound)
+		return
+	} else if errors.Is(err, lib.ErrHistoryDisabled) {
+		http.Error(w, "History disabled", http.StatusNotImplemented)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
+
+// handleGetCatalog handles GET /catalog requests
+// This returns the query templates as JSON, or as CSV with ?format=csv, in the format accepted by the catalog config.
+func (s *Server) handleGetCatalog(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET requests
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	db, ok := s.db(w, r)
+	if !ok {
+		return
+	}
+
+	catalog := db.GetCatalog()
+
+	// Send response
+	if r.URL.Query().Get("format") == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		lib.WriteCatalogCSV(w, catalog)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(catalog)
+}
+
+// handleAdminCurve handles GET and POST /admin/curve requests
+// GET returns the active load curve, and POST replaces it with the curve in the request body.
+func (s *Server) handleAdminCurve(w http.ResponseWriter, r *http.Request) {
+	db, ok := s.db(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var request CurveRequest
+		err := json.NewDecoder(r.Body).Decode(&request)
+		entry := AuditEntry{
+			Database: s.dbName(r),
+			Actor:    request.Actor,
+			Reason:   request.Reason,
+			Action:   AuditCurve,
+			Curve:    request.Name,
+		}
+		if err != nil {
+			s.respond(w, entry, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+		if err := db.SetLoadCurve(request.CurveConfig); err != nil {
+			s.respond(w, entry, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.record(entry, http.StatusOK, "")
+		log.Info().Str("Curve", request.Name).Str("Actor", entry.Actor).Msg("Load curve changed")
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(db.GetLoadCurve())
 }
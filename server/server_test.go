@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"alertwest-interview-q1/lib"
+
+	"github.com/google/uuid"
+)
+
+// newTestDB returns a running database that ticks quickly and keeps its executions queued
+func (s *TestSuite) newTestDB(update func(cfg *lib.Config)) *lib.DB {
+	cfg := lib.DefaultConfig()
+	cfg.Tickrate = 1000
+	cfg.DefaultDelay = 1000
+	if update != nil {
+		update(&cfg)
+	}
+	db, err := lib.NewDBWithConfig(cfg)
+	s.Require().NoError(err)
+	db.Run()
+	return db
+}
+
+// waitQueued waits until the database has queued an execution and returns it
+func (s *TestSuite) waitQueued(db *lib.DB) *lib.QueuedOperation {
+	var queued []*lib.QueuedOperation
+	s.Require().Eventually(func() bool {
+		queued = db.GetQueued()
+		return len(queued) > 0
+	}, 5*time.Second, 5*time.Millisecond)
+	return queued[0]
+}
+
+// serve sends a request to the server and returns the recorded response
+func serve(server *Server, method, target string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(method, target, nil))
+	return recorder
+}
+
+// post sends a POST request with the body to the server and returns the recorded response
+func post(server *Server, target, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, target, strings.NewReader(body)))
+	return recorder
+}
+
+func (s *TestSuite) TestGetExecution() {
+	db := s.newTestDB(nil)
+	server := NewServer([]Database{{Name: DefaultDatabase, DB: db}})
+	operation := s.waitQueued(db)
+
+	recorder := serve(server, http.MethodGet, "/executions/"+operation.Execution.ID)
+	s.Require().Equal(http.StatusOK, recorder.Code)
+	var history lib.ExecutionHistory
+	s.NoError(json.NewDecoder(recorder.Body).Decode(&history))
+	s.Equal(operation.Execution.ID, history.ID)
+	s.Equal(operation.Query.ID, history.Query)
+	s.NotEmpty(history.Transitions)
+
+	s.Equal(http.StatusOK, serve(server, http.MethodGet, "/db/"+DefaultDatabase+"/executions/"+operation.Execution.ID).Code)
+	s.Equal(http.StatusNotFound, serve(server, http.MethodGet, "/executions/"+uuid.NewString()).Code)
+	s.Equal(http.StatusBadRequest, serve(server, http.MethodGet, "/executions/not-an-id").Code)
+	s.Equal(http.StatusMethodNotAllowed, serve(server, http.MethodPost, "/executions/"+operation.Execution.ID).Code)
+}
+
+func (s *TestSuite) TestGetExecutionHistoryDisabled() {
+	db := s.newTestDB(func(cfg *lib.Config) { cfg.History.Retention = 0 })
+	server := NewServer([]Database{{Name: DefaultDatabase, DB: db}})
+	operation := s.waitQueued(db)
+
+	// Without history every execution would be missing, so the API says why instead
+	s.Equal(http.StatusNotImplemented, serve(server, http.MethodGet, "/executions/"+operation.Execution.ID).Code)
+}
+
+func (s *TestSuite) TestGetDatabases() {
+	orders := s.newTestDB(nil)
+	s.waitQueued(orders)
+	server := NewServer([]Database{{Name: "orders", DB: orders}, {Name: "billing", DB: lib.NewDB()}})
+
+	recorder := serve(server, http.MethodGet, "/db")
+	s.Require().Equal(http.StatusOK, recorder.Code)
+	var summaries []DatabaseSummary
+	s.NoError(json.NewDecoder(recorder.Body).Decode(&summaries))
+	s.Require().Len(summaries, 2)
+	s.Equal("orders", summaries[0].Name)
+	s.Positive(summaries[0].Queued)
+	s.Equal(DatabaseSummary{Name: "billing"}, summaries[1])
+	s.Equal(http.StatusMethodNotAllowed, serve(server, http.MethodPost, "/db").Code)
+}
+
+func (s *TestSuite) TestDatabaseRoutes() {
+	orders := s.newTestDB(nil)
+	s.waitQueued(orders)
+	server := NewServer([]Database{{Name: "orders", DB: orders}, {Name: "billing", DB: lib.NewDB()}})
+
+	// Each database is served under its name, and the first one without a prefix as well
+	queued := func(target string) []*lib.QueuedOperation {
+		recorder := serve(server, http.MethodGet, target)
+		s.Require().Equal(http.StatusOK, recorder.Code, target)
+		var operations []*lib.QueuedOperation
+		s.NoError(json.NewDecoder(recorder.Body).Decode(&operations))
+		return operations
+	}
+	s.NotEmpty(queued("/db/orders/queued"))
+	s.NotEmpty(queued("/queued"))
+	s.Equal(http.StatusNoContent, serve(server, http.MethodGet, "/db/billing/queued").Code)
+	s.Equal(http.StatusNotFound, serve(server, http.MethodGet, "/db/inventory/queued").Code)
+}
+
+func (s *TestSuite) TestPostRoute() {
+	db := s.newTestDB(func(cfg *lib.Config) {
+		cfg.Cluster = lib.ClusterConfig{Replicas: 2, Routing: lib.RoundRobinRouter}
+	})
+	server := NewServer([]Database{{Name: DefaultDatabase, DB: db}})
+	operation := s.waitQueued(db)
+	id := operation.Execution.ID
+
+	s.Equal(http.StatusOK, post(server, "/route", `{"id": "`+id+`", "node": "replica-2", "actor": "oncall"}`).Code)
+	entries := server.audit.query(AuditFilter{Action: AuditRoute})
+	s.Require().Len(entries, 1)
+	s.Equal("oncall", entries[0].Actor)
+	s.Equal("replica-2", entries[0].Node)
+
+	s.Equal(http.StatusNotFound, post(server, "/route", `{"id": "`+id+`", "node": "replica-3"}`).Code)
+	s.Equal(http.StatusNotFound, post(server, "/route", `{"id": "`+uuid.NewString()+`", "node": "primary"}`).Code)
+	s.Equal(http.StatusBadRequest, post(server, "/route", `{"node": "primary"}`).Code)
+	s.Equal(http.StatusBadRequest, post(server, "/route", `not json`).Code)
+	s.Equal(http.StatusMethodNotAllowed, serve(server, http.MethodGet, "/route").Code)
+}
+
+func (s *TestSuite) TestPostRouteWrite() {
+	db := s.newTestDB(func(cfg *lib.Config) {
+		cfg.Cluster = lib.ClusterConfig{Replicas: 1, Routing: lib.RoundRobinRouter, Writes: 1}
+	})
+	server := NewServer([]Database{{Name: DefaultDatabase, DB: db}})
+	operation := s.waitQueued(db)
+	s.True(operation.Execution.Write)
+
+	// Writes stay on the primary
+	s.Equal(http.StatusConflict, post(server, "/route", `{"id": "`+operation.Execution.ID+`", "node": "replica-1"}`).Code)
+	s.Equal(http.StatusOK, post(server, "/route", `{"id": "`+operation.Execution.ID+`", "node": "primary"}`).Code)
+}
+
+func (s *TestSuite) TestGetNodes() {
+	db := s.newTestDB(func(cfg *lib.Config) {
+		cfg.Cluster = lib.ClusterConfig{Replicas: 2, Routing: lib.RoundRobinRouter}
+	})
+	server := NewServer([]Database{{Name: DefaultDatabase, DB: db}, {Name: "single", DB: lib.NewDB()}})
+
+	recorder := serve(server, http.MethodGet, "/nodes")
+	s.Require().Equal(http.StatusOK, recorder.Code)
+	var nodes []lib.NodeMetrics
+	s.NoError(json.NewDecoder(recorder.Body).Decode(&nodes))
+	s.Require().Len(nodes, 3)
+	s.Equal(lib.PrimaryNode, nodes[0].Name)
+	s.True(nodes[0].Primary)
+	s.Equal("replica-2", nodes[2].Name)
+
+	// A database without a cluster has no nodes to report
+	s.Equal(http.StatusNoContent, serve(server, http.MethodGet, "/db/single/nodes").Code)
+	s.Equal(http.StatusMethodNotAllowed, post(server, "/nodes", "").Code)
+}